@@ -0,0 +1,210 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// caseIndex is a tree of the lowercased routes of one method. A
+// case-insensitive lookup is then a regular walk of the tree with the
+// lowercased request path.
+type caseIndex struct {
+	root   *node
+	routes map[string]caseRoute // lowercased path => registered route
+}
+
+type caseRoute struct {
+	route    *Route
+	segments []caseSegment
+}
+
+// caseSegment is a static part or a wildcard of a registered path.
+type caseSegment struct {
+	static   string // unescaped, in the registered case
+	lowerLen int    // length of the lowercased static part
+	wildcard byte   // ':' or '*' for wildcards, 0 for static parts
+}
+
+// newCaseIndex builds the index of the given routes. It returns nil if two of
+// the routes can not be told apart once they are lowercased, e.g. /Foo and
+// /foo.
+func newCaseIndex(routes []*Route) (ci *caseIndex) {
+	defer func() {
+		if recover() != nil {
+			ci = nil
+		}
+	}()
+
+	lowerTableOnce.Do(initLowerTable)
+
+	ci = &caseIndex{
+		root:   new(node),
+		routes: make(map[string]caseRoute, len(routes)),
+	}
+	for _, route := range routes {
+		path := strings.Map(unicode.ToLower, route.path)
+		ci.root.addRoute(path, route.handle)
+		ci.routes[path] = caseRoute{route, caseSegments(route.path)}
+	}
+	return ci
+}
+
+func caseSegments(path string) []caseSegment {
+	var segments []caseSegment
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			break
+		}
+		if wildcard[0] == '*' {
+			// The value of a catch-all parameter includes the leading '/'
+			i--
+		}
+		if i > 0 {
+			static := unescapePath(path[:i])
+			segments = append(segments, caseSegment{
+				static:   static,
+				lowerLen: len(strings.Map(unicode.ToLower, static)),
+			})
+		}
+		segments = append(segments, caseSegment{wildcard: wildcard[0]})
+		path = path[i+len(wildcard):]
+		if wildcard[0] == '*' {
+			path = path[1:]
+		}
+	}
+	if len(path) > 0 {
+		static := unescapePath(path)
+		segments = append(segments, caseSegment{
+			static:   static,
+			lowerLen: len(strings.Map(unicode.ToLower, static)),
+		})
+	}
+	return segments
+}
+
+// lowerTable holds the lowercase of all 2-byte runes, or 0 if lowercasing
+// changes the length of the rune.
+var (
+	lowerTable     [0x800 - utf8.RuneSelf]uint16
+	lowerTableOnce sync.Once
+)
+
+func initLowerTable() {
+	for i := range lowerTable {
+		lr := unicode.ToLower(rune(i + utf8.RuneSelf))
+		if utf8.RuneLen(lr) == 2 {
+			lowerTable[i] = uint16(lr)
+		}
+	}
+}
+
+// lowerPath returns the lowercase of the given path. It reports false if
+// lowercasing changes the length of any rune in the path, since the offsets
+// in both paths are then different.
+func lowerPath(path string) (string, bool) {
+	var arr [128]byte
+	buf := arr[:0]
+	for i := 0; i < len(path); {
+		if c := path[i]; c < utf8.RuneSelf {
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			buf = append(buf, c)
+			i++
+			continue
+		}
+
+		// Fast path for 2-byte runes like Latin, Greek or Cyrillic letters
+		if c := path[i]; c&0xE0 == 0xC0 && i+1 < len(path) && path[i+1]&0xC0 == 0x80 {
+			r := rune(c&0x1F)<<6 | rune(path[i+1]&0x3F)
+			if r < utf8.RuneSelf {
+				return "", false // overlong encoding
+			}
+			lr := lowerTable[r-utf8.RuneSelf]
+			if lr == 0 {
+				return "", false
+			}
+			buf = append(buf, 0xC0|byte(lr>>6), 0x80|byte(lr&0x3F))
+			i += 2
+			continue
+		}
+
+		// Invalid UTF-8 is decoded as utf8.RuneError, which is longer
+		r, w := utf8.DecodeRuneInString(path[i:])
+		lr := unicode.ToLower(r)
+		if utf8.RuneLen(lr) != w {
+			return "", false
+		}
+		buf = utf8.AppendRune(buf, lr)
+		i += w
+	}
+	return string(buf), true
+}
+
+// find makes a case-insensitive lookup of the given path like
+// node.findCaseInsensitivePath. It reports false as ok if the path can not be
+// looked up in the index, in which case the caller must fall back to the
+// regular lookup.
+func (ci *caseIndex) find(path string, fixTrailingSlash bool) (fixedPath string, found, ok bool) {
+	lower, ok := lowerPath(path)
+	if !ok {
+		return "", false, false
+	}
+
+	if fixedPath, found = ci.lookup(path, lower); found || !fixTrailingSlash {
+		return fixedPath, found, true
+	}
+
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		fixedPath, found = ci.lookup(path[:len(path)-1], lower[:len(lower)-1])
+	} else {
+		fixedPath, found = ci.lookup(path+"/", lower+"/")
+	}
+	return fixedPath, found, true
+}
+
+// lookup looks up the lowercased path and builds the fixed path from the
+// registered path of the route found and the values of its wildcards in path.
+func (ci *caseIndex) lookup(path, lower string) (string, bool) {
+	leaf, _, _ := ci.root.getValue(lower, nil)
+	if leaf == nil {
+		return "", false
+	}
+
+	// Use a static sized buffer on the stack in the common case
+	var arr [128]byte
+	buf := arr[:0]
+	off := 0
+	cr := ci.routes[leaf.fullPath]
+	if !cr.route.Enabled() {
+		return "", false
+	}
+	for _, seg := range cr.segments {
+		switch seg.wildcard {
+		case 0:
+			buf = append(buf, seg.static...)
+			off += seg.lowerLen
+		case ':':
+			end := strings.IndexByte(path[off:], '/')
+			if end < 0 {
+				end = len(path) - off
+			}
+			buf = append(buf, path[off:off+end]...)
+			off += end
+		case '*':
+			if countSegments(path[off:]) < cr.route.minCatchAllSegments {
+				return "", false
+			}
+			buf = append(buf, path[off:]...)
+			off = len(path)
+		}
+	}
+	return string(buf), true
+}
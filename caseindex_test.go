@@ -0,0 +1,177 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCaseIndex(t *testing.T) {
+	paths := [...]string{
+		"/hi",
+		"/b/",
+		"/ABC/",
+		"/search/:query",
+		"/cmd/:tool/",
+		"/src/*filepath",
+		"/x/y",
+		"/y/",
+		"/0/:id/1",
+		"/doc/go_faq.html",
+		"/Π",
+		"/u/äpfêl/",
+		"/v/Öpfêl",
+		"/w/♬",
+		"/w/𠜏/",
+		"/user/:name/Ärger/*rest",
+		"/esc/\\:colon",
+	}
+	routes := make([]*Route, len(paths))
+	tree := &node{}
+	for i, path := range paths {
+		routes[i] = &Route{path: path, handle: fakeHandler(path)}
+		routes[i].leaf = tree.addRoute(path, fakeHandler(path))
+		routes[i].leaf.route = routes[i]
+	}
+
+	ci := newCaseIndex(routes)
+	if ci == nil {
+		t.Fatal("Building the index failed")
+	}
+
+	tests := []string{
+		"/HI",
+		"/HI/",
+		"/B",
+		"/abc",
+		"/aBc/",
+		"/SEARCH/QUERY",
+		"/SEARCH/QUERY/",
+		"/CMD/TOOL",
+		"/SRC/FILE/PATH",
+		"/SRC/",
+		"/X/Y/",
+		"/Y",
+		"/0/ID/1",
+		"/DOC/GO_FAQ.HTML",
+		"/π/",
+		"/U/ÄPFÊL",
+		"/v/öpfêL/",
+		"/W/♬/",
+		"/w/𠜏",
+		"/USER/Gopher/ärger/A/B",
+		"/ESC/:COLON",
+		"/NO",
+		"/doc/go",
+	}
+	for _, fixTrailingSlash := range []bool{true, false} {
+		for _, path := range tests {
+			want, wantFound := tree.findCaseInsensitivePath(path, fixTrailingSlash)
+			got, found, ok := ci.find(path, fixTrailingSlash)
+			if !ok {
+				t.Errorf("Index lookup of '%s' not possible", path)
+			} else if found != wantFound || got != want {
+				t.Errorf("Wrong result for '%s' (fixTrailingSlash=%v): got %s, %v; want %s, %v",
+					path, fixTrailingSlash, got, found, want, wantFound)
+			}
+		}
+	}
+
+	// lowercasing changes the length of the Kelvin sign and of invalid UTF-8
+	for _, path := range []string{"/K", "/\xff"} {
+		if _, _, ok := ci.find(path, true); ok {
+			t.Errorf("Index lookup of '%s' must not be possible", path)
+		}
+	}
+
+	// routes which can not be told apart in lowercase
+	ci = newCaseIndex([]*Route{
+		{path: "/Foo", handle: fakeHandler("/Foo")},
+		{path: "/foo", handle: fakeHandler("/foo")},
+	})
+	if ci != nil {
+		t.Error("Building an ambiguous index did not fail")
+	}
+}
+
+func TestRouterOptimize(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/Straße/:name", handlerFunc)
+	router.Optimize()
+	if router.caseIndexes[http.MethodGet] == nil {
+		t.Fatal("No index was built for GET")
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/STRAßE/Gopher/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if location := w.Header().Get("Location"); w.Code != http.StatusMovedPermanently || location != "/Stra%C3%9Fe/Gopher" {
+		t.Errorf("Redirect with index failed: Code=%d, Location=%s", w.Code, location)
+	}
+
+	// registering a route discards the index of its method
+	router.GET("/new", handlerFunc)
+	if router.caseIndexes[http.MethodGet] != nil {
+		t.Error("Index was not discarded")
+	}
+	r, _ = http.NewRequest(http.MethodGet, "/NEW", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if location := w.Header().Get("Location"); w.Code != http.StatusMovedPermanently || location != "/new" {
+		t.Errorf("Redirect without index failed: Code=%d, Location=%s", w.Code, location)
+	}
+}
+
+func benchmarkFixedPath(b *testing.B, optimize bool) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	for _, path := range []string{
+		"/ärzte/:id",
+		"/ärzte/:id/öffnungszeiten",
+		"/ärzte/:id/überweisungen",
+		"/ärzte/:id/überweisungen/:nr",
+		"/ämter/:id/öffnungszeiten",
+		"/öffentlich/städte/:stadt/straßen/:straße",
+		"/öffentlich/städte/:stadt/plätze",
+		"/öffentlich/ämter",
+		"/übersicht/*rest",
+		"/грамматика/существительные/:слово",
+		"/грамматика/глаголы/:слово",
+		"/статьи/:id",
+	} {
+		router.GET(path, handlerFunc)
+	}
+	if optimize {
+		router.Optimize()
+	}
+	paths := []string{
+		"/ÖFFENTLICH/STÄDTE/Köln/PLÄTZE",
+		"/ÄRZTE/42/ÜBERWEISUNGEN/7",
+		"/ГРАММАТИКА/ГЛАГОЛЫ/идти",
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			if _, found := router.findCaseInsensitivePath(http.MethodGet, path); !found {
+				b.Fatal("path not found: " + path)
+			}
+		}
+	}
+}
+
+func BenchmarkFixedPathNonASCII(b *testing.B) {
+	benchmarkFixedPath(b, false)
+}
+
+func BenchmarkFixedPathNonASCIIOptimized(b *testing.B) {
+	benchmarkFixedPath(b, true)
+}
@@ -0,0 +1,184 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the minimum size of a response body compressed by
+// Route.Compress. Smaller bodies are hardly reduced by compression.
+const minCompressSize = 1024
+
+// compressedTypes are prefixes of the content types of already compressed
+// content, which is not compressed again by Route.Compress.
+var compressedTypes = []string{
+	"image/gif",
+	"image/jpeg",
+	"image/png",
+	"image/webp",
+	"audio/",
+	"video/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+}
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// compress compresses the responses of the handle with gzip, if the client
+// accepts it, see Route.Compress.
+func compress(handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if req.Method == http.MethodHead || encodingQuality(req.Header.Get("Accept-Encoding"), "gzip") <= 0 {
+			handle(w, req, ps)
+			return
+		}
+
+		// The buffered response is discarded if the handle panics, so that
+		// the PanicHandler can still send an error response
+		cw := &compressWriter{ResponseWriter: w}
+		handle(cw, req, ps)
+		cw.close()
+	}
+}
+
+// compressWriter buffers the beginning of the response body to decide whether
+// it is compressed, which is the case if it reaches minCompressSize and its
+// content is not compressed already.
+type compressWriter struct {
+	http.ResponseWriter
+	code    int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.code == 0 {
+		cw.code = code
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.decided {
+		if cw.gz != nil {
+			return cw.gz.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) < minCompressSize {
+		return len(p), nil
+	}
+	if err := cw.decide(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// decide writes the header and the buffered body, compressed if the response
+// qualifies for compression.
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+
+	h := cw.ResponseWriter.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		// Detect the type from the uncompressed body, like net/http would
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if len(cw.buf) >= minCompressSize && h.Get("Content-Encoding") == "" &&
+		compressibleStatus(cw.code) && compressibleType(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		cw.gz = gzipWriterPool.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+
+	if cw.code != 0 {
+		cw.ResponseWriter.WriteHeader(cw.code)
+	}
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.gz != nil {
+		_, err = cw.gz.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// close writes the rest of the response once the handle returned.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.gz != nil {
+		cw.gz.Close()
+		cw.gz.Reset(io.Discard)
+		gzipWriterPool.Put(cw.gz)
+		cw.gz = nil
+	}
+}
+
+// FlushError flushes the response, see http.ResponseController. The response
+// is not compressed, if the body written so far is below minCompressSize.
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided {
+		if err := cw.decide(); err != nil {
+			return err
+		}
+	}
+	if cw.gz != nil {
+		if err := cw.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Flush implements the http.Flusher interface.
+func (cw *compressWriter) Flush() {
+	cw.FlushError()
+}
+
+// Unwrap returns the wrapped http.ResponseWriter. It is used by
+// http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func compressibleStatus(code int) bool {
+	return code == 0 || (code >= 200 && code < 300 &&
+		code != http.StatusNoContent && code != http.StatusPartialContent)
+}
+
+func compressibleType(contentType string) bool {
+	for _, t := range compressedTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
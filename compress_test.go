@@ -0,0 +1,90 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteCompress(t *testing.T) {
+	big := `{"items":[` + strings.Repeat(`"gopher",`, 200) + `"end"]}`
+
+	router := New()
+	router.GETR("/api/big", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		for i := 0; i < len(big); i += 100 {
+			w.Write([]byte(big[i:min(i+100, len(big))]))
+		}
+	}).Compress()
+	router.GETR("/api/small", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}).Compress()
+	router.GETR("/image", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(big))
+	}).Compress()
+	router.GET("/plain", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte(big))
+	})
+
+	tests := []struct {
+		path       string
+		accept     string
+		compressed bool
+		body       string
+		vary       bool
+	}{
+		{"/api/big", "gzip, deflate, br", true, big, true},
+		{"/api/big", "", false, big, true},
+		{"/api/big", "gzip;q=0, br", false, big, true},
+		{"/api/small", "gzip", false, `{"ok":true}`, true},
+		{"/image", "gzip", false, big, true},
+		{"/plain", "gzip", false, big, false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		body := w.Body.String()
+		if compressed := w.Header().Get("Content-Encoding") == "gzip"; compressed != test.compressed {
+			t.Errorf("Wrong compression of %s with %q: want %v, got %v", test.path, test.accept, test.compressed, compressed)
+			continue
+		} else if compressed {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = string(b)
+		}
+		if body != test.body {
+			t.Errorf("Wrong body of %s with %q: %q", test.path, test.accept, body)
+		}
+		if vary := w.Header().Get("Vary") == "Accept-Encoding"; vary != test.vary {
+			t.Errorf("Wrong Vary header of %s: %q", test.path, w.Header().Get("Vary"))
+		}
+	}
+
+	// the status and the content type are kept
+	r, _ := http.NewRequest(http.MethodGet, "/api/big", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Wrong header of the compressed response: Code=%d, Header=%v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORS is a configuration of the Cross-Origin Resource Sharing headers the
+// router sets on automatic replies to CORS preflight requests, i.e. OPTIONS
+// requests with an Origin and an Access-Control-Request-Method header.
+// See Router.CORS and Route.CORS.
+// The headers of the actual (non-preflight) responses must still be set by the
+// handlers.
+type CORS struct {
+	// The origins which are allowed to access the resource, e.g.
+	// "https://example.com". The origin "*" allows access from any origin.
+	// If the origin of a request is not allowed, no CORS headers are set.
+	AllowOrigins []string
+
+	// The request headers which are allowed in the actual request.
+	AllowHeaders []string
+
+	// If enabled, the Access-Control-Allow-Credentials header is set.
+	AllowCredentials bool
+}
+
+func (c *CORS) allowsOrigin(origin string) bool {
+	for _, o := range c.AllowOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// setPreflightHeaders sets the headers of a reply to a preflight request from
+// the given origin. allow is the list of allowed methods.
+func (c *CORS) setPreflightHeaders(header http.Header, origin, allow string) {
+	header.Add("Vary", "Origin")
+	if !c.allowsOrigin(origin) {
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Set("Access-Control-Allow-Methods", allow)
+	if len(c.AllowHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(c.AllowHeaders, ", "))
+	}
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// CORS sets the CORS configuration for preflight requests to the path of the
+// route, which overrides Router.CORS. The configuration of the route of the
+// method requested by the Access-Control-Request-Method header is used.
+func (rt *Route) CORS(cors *CORS) *Route {
+	rt.cors = cors
+	return rt
+}
+
+// corsFor returns the CORS configuration for a preflight request for the given
+// path and method.
+func (r *Router) corsFor(path, method string) *CORS {
+	if root := r.trees[method]; root != nil {
+		if leaf, _, _ := root.getValue(path, nil); leaf != nil && leaf.route != nil && leaf.route.cors != nil {
+			return leaf.route.cors
+		}
+	}
+	return r.CORS
+}
@@ -0,0 +1,139 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterCORS(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.CORS = &CORS{
+		AllowOrigins: []string{"*"},
+	}
+	router.GET("/public", handlerFunc)
+	router.GETR("/private/:id", handlerFunc).CORS(&CORS{
+		AllowOrigins:     []string{"https://example.com"},
+		AllowHeaders:     []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+	})
+	router.DELETE("/private/:id", handlerFunc)
+	router.GETR("/static/file", handlerFunc).CORS(&CORS{
+		AllowOrigins: []string{"https://example.com"},
+	})
+	// split the edge of the leaf of /static/file
+	router.GET("/static", handlerFunc)
+
+	testRequests := []struct {
+		route   string
+		origin  string
+		method  string
+		headers map[string]string
+	}{
+		// global configuration
+		{"/public", "https://other.com", http.MethodGet, map[string]string{
+			"Allow":                            "GET, OPTIONS",
+			"Access-Control-Allow-Origin":      "https://other.com",
+			"Access-Control-Allow-Methods":     "GET, OPTIONS",
+			"Access-Control-Allow-Headers":     "",
+			"Access-Control-Allow-Credentials": "",
+			"Vary":                             "Origin",
+		}},
+		// route configuration
+		{"/private/1", "https://example.com", http.MethodGet, map[string]string{
+			"Allow":                            "DELETE, GET, OPTIONS",
+			"Access-Control-Allow-Origin":      "https://example.com",
+			"Access-Control-Allow-Methods":     "DELETE, GET, OPTIONS",
+			"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+			"Access-Control-Allow-Credentials": "true",
+		}},
+		{"/private/1", "https://other.com", http.MethodGet, map[string]string{
+			"Allow":                       "DELETE, GET, OPTIONS",
+			"Access-Control-Allow-Origin": "",
+			"Vary":                        "Origin",
+		}},
+		// the route of the requested method has no CORS configuration
+		{"/private/1", "https://other.com", http.MethodDelete, map[string]string{
+			"Access-Control-Allow-Origin": "https://other.com",
+		}},
+		// route configuration after splitting its leaf
+		{"/static/file", "https://other.com", http.MethodGet, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"/static/file", "https://example.com", http.MethodGet, map[string]string{
+			"Access-Control-Allow-Origin": "https://example.com",
+		}},
+		// no preflight
+		{"/public", "https://other.com", "", map[string]string{
+			"Allow":                       "GET, OPTIONS",
+			"Access-Control-Allow-Origin": "",
+		}},
+	}
+	for _, tr := range testRequests {
+		r, _ := http.NewRequest(http.MethodOptions, tr.route, nil)
+		r.Header.Set("Origin", tr.origin)
+		if tr.method != "" {
+			r.Header.Set("Access-Control-Request-Method", tr.method)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Preflight for %s from %s failed: Code=%d", tr.route, tr.origin, w.Code)
+		}
+		for k, v := range tr.headers {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("Wrong %s header for %s from %s: want %q, got %q", k, tr.route, tr.origin, v, got)
+			}
+		}
+	}
+}
+
+func TestRouterPreflightMaxAge(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.CORS = &CORS{AllowOrigins: []string{"*"}}
+	router.PreflightMaxAge = 10 * time.Minute
+	router.GET("/items", handlerFunc)
+
+	tests := []struct {
+		origin, method string
+		maxAge         string
+	}{
+		{"https://example.com", http.MethodGet, "600"},
+		{"https://example.com", "", ""}, // plain OPTIONS with an Origin
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodOptions, "/items", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.method != "" {
+			r.Header.Set("Access-Control-Request-Method", test.method)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if got := w.Header().Get("Access-Control-Max-Age"); got != test.maxAge {
+			t.Errorf("Wrong Access-Control-Max-Age for Origin=%q, Access-Control-Request-Method=%q: want %q, got %q",
+				test.origin, test.method, test.maxAge, got)
+		}
+	}
+
+	router.PreflightMaxAge = 0
+	r, _ := http.NewRequest(http.MethodOptions, "/items", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if _, ok := w.Header()["Access-Control-Max-Age"]; ok {
+		t.Error("Access-Control-Max-Age set although PreflightMaxAge is 0")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "net/http"
+
+// ErrorPage registers a handler which renders the error page for the given
+// status code, e.g. 404 or 500. It is used for all responses with this status
+// code the router generates itself, including the 500 of Router.Recover,
+// instead of the default plain text reply, see Error. Handlers which are set
+// explicitly for a case, like NotFound, MethodNotAllowed or InvalidParams,
+// still take priority.
+// The handler may set headers like Content-Type and write the body. If it
+// does not write the header itself, the status code is written before the
+// body.
+func (r *Router) ErrorPage(code int, handler http.HandlerFunc) {
+	if code < 400 || code > 599 {
+		panic("status code of an error page must be in the range 400 to 599")
+	}
+	if r.errorPages == nil {
+		r.errorPages = make(map[int]http.Handler)
+	}
+	r.errorPages[code] = handler
+}
+
+// Error replies to the request with the error page registered for the given
+// status code, see ErrorPage, or with the status text of the code as plain
+// text, like http.Error, or http.NotFound for 404. It is used by the router
+// for the error responses it generates, but can also be called by handles,
+// e.g. to reply with 413 (Request Entity Too Large) if reading the body fails
+// because of MaxBodyBytes, or by a PanicHandler to reply with 500 (Internal
+// Server Error).
+func (r *Router) Error(w http.ResponseWriter, req *http.Request, code int) {
+	if handler := r.errorPages[code]; handler != nil {
+		ew := &errorPageWriter{ResponseWriter: w, code: code}
+		handler.ServeHTTP(ew, req)
+		if !ew.wroteHeader {
+			ew.WriteHeader(code)
+		}
+		return
+	}
+	if code == http.StatusNotFound {
+		http.NotFound(w, req)
+		return
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// errorPageWriter writes the status code of the error page, if the handler of
+// the page does not write the header itself.
+type errorPageWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *errorPageWriter) WriteHeader(code int) {
+	if code >= 200 {
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorPageWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(w.code)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter. It is used by
+// http.ResponseController.
+func (w *errorPageWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
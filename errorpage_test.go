@@ -0,0 +1,83 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterErrorPage(t *testing.T) {
+	router := New()
+	router.MaxBodyBytes = 4
+	router.ErrorPage(http.StatusNotFound, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<h1>"+r.URL.Path+" not found</h1>")
+	})
+	router.ErrorPage(http.StatusRequestEntityTooLarge, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		io.WriteString(w, "<h1>too large</h1>")
+	})
+	router.ErrorPage(http.StatusGone, func(_ http.ResponseWriter, _ *http.Request) {})
+	router.POST("/upload", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		var maxBytesErr *http.MaxBytesError
+		if _, err := io.ReadAll(r.Body); errors.As(err, &maxBytesErr) {
+			router.Error(w, r, http.StatusRequestEntityTooLarge)
+		}
+	})
+	router.Gone(http.MethodGet, "/old")
+
+	testRequests := []struct {
+		route  string
+		body   io.Reader
+		code   int
+		header string
+		resp   string
+	}{
+		{"/nope", nil, http.StatusNotFound, "text/html; charset=utf-8", "<h1>/nope not found</h1>"},
+		{"/upload", strings.NewReader("12345"), http.StatusRequestEntityTooLarge, "", "<h1>too large</h1>"},
+		{"/old", nil, http.StatusGone, "", ""},
+	}
+	for _, tr := range testRequests {
+		method := http.MethodGet
+		if tr.body != nil {
+			method = http.MethodPost
+		}
+		r, _ := http.NewRequest(method, tr.route, tr.body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || w.Body.String() != tr.resp ||
+			(tr.header != "" && w.Header().Get("Content-Type") != tr.header) {
+			t.Errorf("Wrong error page for %s: Code=%d, Body=%q, Header=%v", tr.route, w.Code, w.Body.String(), w.Header())
+		}
+	}
+
+	// status codes without an error page keep the default reply
+	r, _ := http.NewRequest(http.MethodPut, "/old", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "Method Not Allowed\n" {
+		t.Errorf("Wrong default reply: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+
+	// an explicitly set NotFound handler takes priority
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r, _ = http.NewRequest(http.MethodGet, "/nope", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("NotFound handler was not used: Code=%d", w.Code)
+	}
+
+	if recv := catchPanic(func() { router.ErrorPage(http.StatusOK, nil) }); recv == nil {
+		t.Error("Registering an error page for 200 did not panic")
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// noListingFileSystem is a http.FileSystem which refuses to open directories
+// without an index.html file, so that http.FileServer does not generate
+// directory listings for them.
+type noListingFileSystem struct {
+	fs http.FileSystem
+}
+
+func (nfs noListingFileSystem) Open(name string) (http.File, error) {
+	f, err := nfs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if stat.IsDir() {
+		index, err := nfs.fs.Open(path.Join(name, "index.html"))
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+
+	return f, nil
+}
+
+// checkFilesPath returns an error, if the path of a file server does not end
+// with "/*filepath", see ServeFiles.
+func checkFilesPath(path string) error {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		return errors.New("path must end with /*filepath in path '" + path + "'")
+	}
+	return nil
+}
+
+// fileServerName returns the name, under which http.FileServer opens the file
+// for the value of the filepath param.
+func fileServerName(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	return path.Clean(name)
+}
+
+// openFileSystem is a http.FileSystem, which returns the already opened file
+// of the given name once, instead of opening it again.
+type openFileSystem struct {
+	http.FileSystem
+	name string
+	f    http.File
+}
+
+func (ofs *openFileSystem) Open(name string) (http.File, error) {
+	if ofs.f != nil && name == ofs.name {
+		f := ofs.f
+		ofs.f = nil
+		return f, nil
+	}
+	return ofs.FileSystem.Open(name)
+}
+
+// serveOpenFile serves the file for the value of the filepath param with a
+// http.FileServer, which uses f, if it is not nil, instead of opening the file
+// again. f is closed afterwards.
+func serveOpenFile(w http.ResponseWriter, req *http.Request, root http.FileSystem, name string, f http.File) {
+	ofs := &openFileSystem{FileSystem: root, name: fileServerName(name), f: f}
+	req.URL.Path = name
+	http.FileServer(ofs).ServeHTTP(w, req)
+	if ofs.f != nil {
+		// Not opened by the file server, e.g. for a redirect
+		ofs.f.Close()
+	}
+}
+
+// serveDirIndex serves the index.html of the directory name of root, if name
+// has no trailing slash. It reports whether it served the request.
+func serveDirIndex(w http.ResponseWriter, req *http.Request, root http.FileSystem, name string) bool {
+	if name == "" || name[len(name)-1] == '/' {
+		return false
+	}
+
+	dir, err := root.Open(CleanPath(name))
+	if err != nil {
+		return false
+	}
+	stat, err := dir.Stat()
+	dir.Close()
+	if err != nil || !stat.IsDir() {
+		return false
+	}
+
+	index, err := root.Open(path.Join(CleanPath(name), "index.html"))
+	if err != nil {
+		return false
+	}
+	defer index.Close()
+	stat, err = index.Stat()
+	if err != nil || stat.IsDir() {
+		return false
+	}
+
+	http.ServeContent(w, req, stat.Name(), stat.ModTime(), index)
+	return true
+}
+
+// ServeFile registers a GET and a HEAD route for the given path, e.g.
+// /favicon.ico, which serve the single file with the given name from the local
+// file system with http.ServeFile, including the support of conditional and
+// range requests. The path must not contain parameters.
+//     router.ServeFile("/robots.txt", "/var/www/robots.txt")
+func (r *Router) ServeFile(path, filePath string) {
+	if countParams(path) > 0 {
+		panic("path must not contain parameters in path '" + path + "'")
+	}
+
+	handle := func(w http.ResponseWriter, req *http.Request, _ Params) {
+		http.ServeFile(w, req, filePath)
+	}
+	r.GET(path, handle)
+	r.HEAD(path, handle)
+}
+
+// ServeFilesNoListing is like ServeFiles, but does not generate directory
+// listings. Requests for directories without an index.html file are answered
+// with http.NotFound, while an existing index.html is still served.
+//     router.ServeFilesNoListing("/src/*filepath", http.Dir("/var/www"))
+func (r *Router) ServeFilesNoListing(path string, root http.FileSystem) {
+	r.ServeFiles(path, noListingFileSystem{root})
+}
+
+// ServeFilesCached is like ServeFiles, but sets the Cache-Control header of
+// responses for existing files to "public, max-age=" with the given maxAge in
+// seconds, so that clients and proxies may cache them. A maxAge of 0 disables
+// the header.
+// Additionally, a weak ETag header derived from the modification time and the
+// size of the file is set, so that the conditional requests of clients with
+// an If-None-Match header are answered with 304 Not Modified, like requests
+// with an If-Modified-Since header.
+//     router.ServeFilesCached("/static/*filepath", http.Dir("/var/www"), 24*time.Hour)
+func (r *Router) ServeFilesCached(path string, root http.FileSystem, maxAge time.Duration) {
+	if err := checkFilesPath(path); err != nil {
+		panic(err.Error())
+	}
+
+	cacheControl := "public, max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+
+	handle := func(w http.ResponseWriter, req *http.Request, ps Params) {
+		name := ps.ByName("filepath")
+		f, err := root.Open(fileServerName(name))
+		if err == nil {
+			if stat, err := f.Stat(); err == nil && !stat.IsDir() {
+				if maxAge > 0 {
+					w.Header().Set("Cache-Control", cacheControl)
+				}
+				w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()))
+			}
+		}
+		serveOpenFile(w, req, root, name, f)
+	}
+
+	r.GET(path, handle)
+	r.HEAD(path, handle)
+}
+
+// ServeFilesWithErrorHandler is like ServeFiles, but passes errors opening the
+// requested file other than fs.ErrNotExist, e.g. fs.ErrPermission, to onErr
+// instead of letting http.FileServer answer them with an opaque 403 or 500.
+// This allows to log such errors and to render them distinctly. Requests for
+// files which do not exist are still answered with http.NotFound.
+//     router.ServeFilesWithErrorHandler("/src/*filepath", http.Dir("/var/www"),
+//         func(w http.ResponseWriter, r *http.Request, err error) {...})
+func (r *Router) ServeFilesWithErrorHandler(path string, root http.FileSystem, onErr func(http.ResponseWriter, *http.Request, error)) {
+	if err := checkFilesPath(path); err != nil {
+		panic(err.Error())
+	}
+
+	handle := func(w http.ResponseWriter, req *http.Request, ps Params) {
+		name := ps.ByName("filepath")
+		f, err := root.Open(fileServerName(name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			onErr(w, req, err)
+			return
+		}
+		serveOpenFile(w, req, root, name, f)
+	}
+
+	r.GET(path, handle)
+	r.HEAD(path, handle)
+}
+
+// ServeFilesNegotiated404 is like ServeFiles, but answers requests for files
+// which do not exist with a 404 body in the format the client prefers
+// according to its Accept header: browsers get an HTML page and API clients a
+// JSON object like {"error":"not found"}. Other clients, including those
+// accepting any type with */*, get the plain text of http.NotFound.
+//     router.ServeFilesNegotiated404("/static/*filepath", http.Dir("/var/www"))
+func (r *Router) ServeFilesNegotiated404(path string, root http.FileSystem) {
+	if err := checkFilesPath(path); err != nil {
+		panic(err.Error())
+	}
+
+	handle := func(w http.ResponseWriter, req *http.Request, ps Params) {
+		name := ps.ByName("filepath")
+		f, err := root.Open(fileServerName(name))
+		if errors.Is(err, fs.ErrNotExist) {
+			notFoundNegotiated(w, req)
+			return
+		}
+		serveOpenFile(w, req, root, name, f)
+	}
+
+	r.GET(path, handle)
+	r.HEAD(path, handle)
+}
+
+// notFoundNegotiated replies with 404 in the preferred format of the client.
+func notFoundNegotiated(w http.ResponseWriter, req *http.Request) {
+	switch negotiate(req.Header.Get("Accept"), "text/html", "application/json") {
+	case "text/html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<!DOCTYPE html>\n<title>404 Not Found</title>\n<h1>404 Not Found</h1>\n")
+	case "application/json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"not found"}`+"\n")
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// negotiate returns the offered media type with the highest quality in the
+// given Accept header, preferring earlier offers on ties. Offers only matched
+// by */* are not considered, so that "" is returned if the client has no
+// preference.
+func negotiate(accept string, offers ...string) string {
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality of the media type in the given Accept
+// header, which is taken from the most specific matching media range.
+func acceptQuality(accept, mediaType string) float64 {
+	q, specificity := 0.0, 0
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		spec := 0
+		switch {
+		case mediaRange == mediaType:
+			spec = 2
+		case strings.HasSuffix(mediaRange, "/*") && mediaRange != "*/*" &&
+			strings.HasPrefix(mediaType, mediaRange[:len(mediaRange)-1]):
+			spec = 1
+		}
+		if spec <= specificity {
+			continue
+		}
+
+		specificity, q = spec, 1
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+	}
+	return q
+}
+
+// precompressedEncodings are the content codings of the precompressed files
+// served by ServeFilesPrecompressed with the extensions of the files, in the
+// order of preference.
+var precompressedEncodings = []struct {
+	coding string
+	ext    string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// ServeFilesPrecompressed is like ServeFiles, but serves precompressed
+// versions of the requested files, if the client accepts their content coding
+// according to its Accept-Encoding header. For the file app.js the Brotli
+// compressed file app.js.br is served with the Content-Encoding br and the
+// gzip compressed file app.js.gz with the Content-Encoding gzip, with the
+// Content-Type of app.js. If both are accepted with the same quality, Brotli
+// is preferred. Otherwise, or if no precompressed file exists, the file itself
+// is served. The Vary header of all responses contains Accept-Encoding.
+//     router.ServeFilesPrecompressed("/static/*filepath", http.Dir("/var/www"))
+func (r *Router) ServeFilesPrecompressed(path string, root http.FileSystem) {
+	if err := checkFilesPath(path); err != nil {
+		panic(err.Error())
+	}
+
+	fileServer := http.FileServer(root)
+	handle := func(w http.ResponseWriter, req *http.Request, ps Params) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		name := ps.ByName("filepath")
+		if servePrecompressed(w, req, root, CleanPath(name)) {
+			return
+		}
+
+		req.URL.Path = name
+		fileServer.ServeHTTP(w, req)
+	}
+
+	r.GET(path, handle)
+	r.HEAD(path, handle)
+}
+
+// servePrecompressed serves the precompressed version of the named file with
+// the content coding preferred by the client and reports whether one was
+// served, see ServeFilesPrecompressed.
+func servePrecompressed(w http.ResponseWriter, req *http.Request, root http.FileSystem, name string) bool {
+	if strings.HasSuffix(name, "/") {
+		return false
+	}
+
+	accept := req.Header.Get("Accept-Encoding")
+	var f http.File
+	var stat fs.FileInfo
+	var coding string
+	bestQ := 0.0
+	for _, enc := range precompressedEncodings {
+		q := encodingQuality(accept, enc.coding)
+		if q <= bestQ {
+			continue
+		}
+		ef, err := root.Open(name + enc.ext)
+		if err != nil {
+			continue
+		}
+		s, err := ef.Stat()
+		if err != nil || s.IsDir() {
+			ef.Close()
+			continue
+		}
+		if f != nil {
+			f.Close()
+		}
+		f, stat, coding, bestQ = ef, s, enc.coding, q
+	}
+	if f == nil {
+		return false
+	}
+	defer f.Close()
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Encoding", coding)
+	http.ServeContent(w, req, name, stat.ModTime(), f)
+	return true
+}
+
+// encodingQuality returns the quality of the content coding in the given
+// Accept-Encoding header, which is taken from the coding itself or else from
+// the wildcard "*".
+func encodingQuality(accept, coding string) float64 {
+	q, wildcardQ := -1.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		token, params, _ := strings.Cut(part, ";")
+		token = strings.TrimSpace(token)
+		if !strings.EqualFold(token, coding) && token != "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					quality = f
+				}
+			}
+		}
+		if token == "*" {
+			wildcardQ = quality
+		} else {
+			q = quality
+		}
+	}
+	if q < 0 {
+		return wildcardQ
+	}
+	return q
+}
+
+// ServeFilesMulti serves files from several file systems at once, see
+// ServeFiles. The keys of mounts are the path prefixes, e.g. "/css", each of
+// which is registered with "/*filepath" appended.
+//     router.ServeFilesMulti(map[string]http.FileSystem{
+//         "/css": http.Dir("/var/www/css"),
+//         "/js":  http.Dir("/var/www/js"),
+//     })
+// All prefixes are checked before any route is registered. If some of them
+// are invalid, i.e. do not begin with '/' or contain wildcards, it panics
+// with a message listing all of them.
+func (r *Router) ServeFilesMulti(mounts map[string]http.FileSystem) {
+	prefixes := make([]string, 0, len(mounts))
+	for prefix := range mounts {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var invalid []string
+	for _, prefix := range prefixes {
+		if len(prefix) < 1 || prefix[0] != '/' || strings.ContainsAny(prefix, ":*") {
+			invalid = append(invalid, "'"+prefix+"'")
+		}
+	}
+	if len(invalid) > 0 {
+		panic("invalid file server prefixes " + strings.Join(invalid, ", ") +
+			": prefixes must begin with '/' and must not contain wildcards")
+	}
+
+	for _, prefix := range prefixes {
+		r.ServeFiles(strings.TrimSuffix(prefix, "/")+"/*filepath", mounts[prefix])
+	}
+}
@@ -0,0 +1,416 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createFiles creates the given files with their content as the file name
+// below a new temporary directory and returns the path of that directory.
+func createFiles(t *testing.T, names ...string) string {
+	dir := t.TempDir()
+	for _, name := range names {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRouterServeFile(t *testing.T) {
+	dir := createFiles(t, "robots.txt")
+
+	router := New()
+	router.ServeFile("/robots.txt", filepath.Join(dir, "robots.txt"))
+	router.ServeFile("/missing.txt", filepath.Join(dir, "missing.txt"))
+
+	r, _ := http.NewRequest(http.MethodGet, "/robots.txt", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "robots.txt" {
+		t.Fatalf("serving /robots.txt failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+	lastModified := w.Header().Get("Last-Modified")
+	if lastModified == "" {
+		t.Error("Last-Modified header not set")
+	}
+
+	r, _ = http.NewRequest(http.MethodHead, "/robots.txt", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "10" {
+		t.Errorf("HEAD /robots.txt failed: Code=%d, Body=%q, Header=%v", w.Code, w.Body.String(), w.Header())
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/robots.txt", nil)
+	r.Header.Set("If-Modified-Since", lastModified)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional request failed: Code=%d", w.Code)
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/missing.txt", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("serving a missing file failed: Code=%d", w.Code)
+	}
+
+	if recv := catchPanic(func() {
+		router.ServeFile("/files/:name", dir)
+	}); recv == nil {
+		t.Error("registering a path with parameters did not panic")
+	}
+}
+
+func TestRouterServeFilesNoListing(t *testing.T) {
+	dir := createFiles(t, "list/a.txt", "index/index.html")
+
+	router := New()
+	router.ServeFilesNoListing("/static/*filepath", http.Dir(dir))
+
+	testRoutes := []struct {
+		route string
+		code  int
+		body  string
+	}{
+		{"/static/list/a.txt", http.StatusOK, "list/a.txt"},
+		{"/static/list/", http.StatusNotFound, ""},
+		{"/static/index/", http.StatusOK, "index/index.html"},
+		{"/static/nope", http.StatusNotFound, ""},
+	}
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || (tr.body != "" && w.Body.String() != tr.body) {
+			t.Errorf("serving %s failed: Code=%d, Body=%q", tr.route, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouterServeFilesCached(t *testing.T) {
+	dir := createFiles(t, "app.js")
+
+	router := New()
+	router.ServeFilesCached("/static/*filepath", http.Dir(dir), time.Hour)
+	router.ServeFilesCached("/nocache/*filepath", http.Dir(dir), 0)
+
+	r, _ := http.NewRequest(http.MethodGet, "/static/app.js", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "app.js" || etag == "" {
+		t.Fatalf("serving /static/app.js failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("Wrong Cache-Control header: %q", cc)
+	}
+
+	// conditional requests
+	r, _ = http.NewRequest(http.MethodGet, "/static/app.js", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match request failed: Code=%d", w.Code)
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/static/app.js", nil)
+	r.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since request failed: Code=%d", w.Code)
+	}
+
+	// maxAge 0 disables the Cache-Control header
+	r, _ = http.NewRequest(http.MethodGet, "/nocache/app.js", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if cc := w.Header().Get("Cache-Control"); w.Code != http.StatusOK || cc != "" {
+		t.Errorf("Unexpected Cache-Control header with maxAge 0: Code=%d, Cache-Control=%q", w.Code, cc)
+	}
+
+	// no caching headers for missing files
+	r, _ = http.NewRequest(http.MethodGet, "/static/nope.js", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || w.Header().Get("Cache-Control") != "" || w.Header().Get("ETag") != "" {
+		t.Errorf("Unexpected response for missing file: Code=%d, Header=%v", w.Code, w.Header())
+	}
+}
+
+func TestRouterServeFilesMulti(t *testing.T) {
+	dir := createFiles(t, "css/app.css", "js/app.js", "img/logo.svg")
+
+	router := New()
+	router.ServeFilesMulti(map[string]http.FileSystem{
+		"/css":     http.Dir(filepath.Join(dir, "css")),
+		"/js/":     http.Dir(filepath.Join(dir, "js")),
+		"/app/img": http.Dir(filepath.Join(dir, "img")),
+	})
+
+	testRoutes := []struct {
+		route string
+		code  int
+		body  string
+	}{
+		{"/css/app.css", http.StatusOK, "css/app.css"},
+		{"/js/app.js", http.StatusOK, "js/app.js"},
+		{"/app/img/logo.svg", http.StatusOK, "img/logo.svg"},
+		{"/css/app.js", http.StatusNotFound, ""},
+	}
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || (tr.body != "" && w.Body.String() != tr.body) {
+			t.Errorf("serving %s failed: Code=%d, Body=%q", tr.route, w.Code, w.Body.String())
+		}
+	}
+
+	router = New()
+	recv := catchPanic(func() {
+		router.ServeFilesMulti(map[string]http.FileSystem{
+			"/ok":        http.Dir(dir),
+			"css":        http.Dir(dir),
+			"/js/:name":  http.Dir(dir),
+			"/img/*path": http.Dir(dir),
+		})
+	})
+	want := "invalid file server prefixes '/img/*path', '/js/:name', 'css': " +
+		"prefixes must begin with '/' and must not contain wildcards"
+	if recv != want {
+		t.Errorf("Wrong panic for invalid prefixes: %v", recv)
+	}
+	if len(router.Routes()) != 0 {
+		t.Error("Routes were registered despite invalid prefixes")
+	}
+}
+
+// errorFileSystem is a http.FileSystem which fails to open any file with err.
+type errorFileSystem struct {
+	err error
+}
+
+func (efs errorFileSystem) Open(string) (http.File, error) {
+	return nil, efs.err
+}
+
+func TestRouterServeFilesWithErrorHandler(t *testing.T) {
+	var handledErr error
+	onErr := func(w http.ResponseWriter, _ *http.Request, err error) {
+		handledErr = err
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	dir := createFiles(t, "a.txt")
+	router := New()
+	router.ServeFilesWithErrorHandler("/files/*filepath", http.Dir(dir), onErr)
+	router.ServeFilesWithErrorHandler("/denied/*filepath", errorFileSystem{&os.PathError{
+		Op: "open", Path: "/secret", Err: os.ErrPermission,
+	}}, onErr)
+
+	testRoutes := []struct {
+		route string
+		code  int
+		err   error
+	}{
+		{"/files/a.txt", http.StatusOK, nil},
+		{"/files/nope.txt", http.StatusNotFound, nil},
+		{"/denied/secret", http.StatusServiceUnavailable, os.ErrPermission},
+	}
+	for _, tr := range testRoutes {
+		handledErr = nil
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code {
+			t.Errorf("Wrong status for %s: want %d, got %d", tr.route, tr.code, w.Code)
+		}
+		if (tr.err == nil && handledErr != nil) || (tr.err != nil && !errors.Is(handledErr, tr.err)) {
+			t.Errorf("Wrong error passed to the handler for %s: want %v, got %v", tr.route, tr.err, handledErr)
+		}
+	}
+}
+
+// countingFileSystem is a http.FileSystem which counts the opened files.
+type countingFileSystem struct {
+	fs    http.FileSystem
+	opens map[string]int
+}
+
+func (cfs countingFileSystem) Open(name string) (http.File, error) {
+	cfs.opens[name]++
+	return cfs.fs.Open(name)
+}
+
+func TestRouterServeFilesOpenOnce(t *testing.T) {
+	dir := createFiles(t, "a.txt", "docs/index.html")
+	cfs := countingFileSystem{http.Dir(dir), make(map[string]int)}
+	onErr := func(w http.ResponseWriter, _ *http.Request, _ error) {}
+
+	router := New()
+	router.ServeFilesCached("/cached/*filepath", cfs, time.Hour)
+	router.ServeFilesWithErrorHandler("/checked/*filepath", cfs, onErr)
+	router.ServeFilesNegotiated404("/negotiated/*filepath", cfs)
+
+	for _, prefix := range []string{"/cached", "/checked", "/negotiated"} {
+		for _, name := range []string{"/a.txt", "/docs/index.html"} {
+			clear(cfs.opens)
+			r, _ := http.NewRequest(http.MethodGet, prefix+name, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if n := cfs.opens[name]; n != 1 {
+				t.Errorf("%s%s was opened %d times, Code=%d", prefix, name, n, w.Code)
+			}
+		}
+	}
+}
+
+func TestRouterFileDirIndexNoRedirect(t *testing.T) {
+	dir := createFiles(t, "guide/index.html", "empty/a.txt", "a.txt")
+
+	router := New()
+	router.ServeFiles("/docs/*filepath", http.Dir(dir))
+
+	testRoutes := []struct {
+		route    string
+		noRedir  bool
+		code     int
+		body     string
+		location string
+	}{
+		{"/docs/guide/", false, http.StatusOK, "guide/index.html", ""},
+		{"/docs/guide", false, http.StatusMovedPermanently, "", "guide/"},
+		{"/docs/guide/", true, http.StatusOK, "guide/index.html", ""},
+		{"/docs/guide", true, http.StatusOK, "guide/index.html", ""},
+		// directories without an index.html and files are not affected
+		{"/docs/empty", true, http.StatusMovedPermanently, "", "empty/"},
+		{"/docs/a.txt", true, http.StatusOK, "a.txt", ""},
+	}
+	for _, tr := range testRoutes {
+		router.FileDirIndexNoRedirect = tr.noRedir
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || (tr.body != "" && w.Body.String() != tr.body) ||
+			w.Header().Get("Location") != tr.location {
+			t.Errorf("serving %s (FileDirIndexNoRedirect=%t) failed: Code=%d, Body=%q, Location=%q",
+				tr.route, tr.noRedir, w.Code, w.Body.String(), w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterServeFilesNegotiated404(t *testing.T) {
+	dir := createFiles(t, "a.txt")
+	router := New()
+	router.ServeFilesNegotiated404("/static/*filepath", http.Dir(dir))
+
+	testRequests := []struct {
+		route       string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/static/a.txt", "text/html", http.StatusOK, "text/plain; charset=utf-8", "a.txt"},
+		{"/static/nope", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			http.StatusNotFound, "text/html; charset=utf-8", "<!DOCTYPE html>\n<title>404 Not Found</title>\n<h1>404 Not Found</h1>\n"},
+		{"/static/nope", "application/json", http.StatusNotFound, "application/json", `{"error":"not found"}` + "\n"},
+		{"/static/nope", "text/html;q=0.5, application/json", http.StatusNotFound, "application/json", `{"error":"not found"}` + "\n"},
+		{"/static/nope", "application/*", http.StatusNotFound, "application/json", `{"error":"not found"}` + "\n"},
+		{"/static/nope", "*/*", http.StatusNotFound, "text/plain; charset=utf-8", "404 page not found\n"},
+		{"/static/nope", "", http.StatusNotFound, "text/plain; charset=utf-8", "404 page not found\n"},
+	}
+	for _, tr := range testRequests {
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		if tr.accept != "" {
+			r.Header.Set("Accept", tr.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || w.Header().Get("Content-Type") != tr.contentType || w.Body.String() != tr.body {
+			t.Errorf("Wrong response for %s with Accept %q: Code=%d, Content-Type=%q, Body=%q",
+				tr.route, tr.accept, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestEncodingQuality(t *testing.T) {
+	tests := []struct {
+		accept string
+		coding string
+		want   float64
+	}{
+		{"", "br", 0},
+		{"gzip, br", "br", 1},
+		{"gzip;q=0.8, BR;q=0.5", "br", 0.5},
+		{"*;q=0.3", "gzip", 0.3},
+		{"br;q=0, *", "br", 0},
+		{"deflate", "gzip", 0},
+	}
+	for _, test := range tests {
+		if got := encodingQuality(test.accept, test.coding); got != test.want {
+			t.Errorf("Wrong quality of %s in %q: want %v, got %v", test.coding, test.accept, test.want, got)
+		}
+	}
+}
+
+func TestRouterServeFilesPrecompressed(t *testing.T) {
+	dir := createFiles(t, "app.js", "app.js.br", "app.js.gz", "style.css", "style.css.gz", "plain.txt")
+
+	router := New()
+	router.ServeFilesPrecompressed("/static/*filepath", http.Dir(dir))
+
+	tests := []struct {
+		path     string
+		accept   string
+		body     string
+		encoding string
+	}{
+		{"/static/app.js", "gzip, deflate, br", "app.js.br", "br"},
+		{"/static/app.js", "gzip", "app.js.gz", "gzip"},
+		{"/static/app.js", "br;q=0.5, gzip", "app.js.gz", "gzip"},
+		{"/static/app.js", "*", "app.js.br", "br"},
+		{"/static/app.js", "", "app.js", ""},
+		{"/static/style.css", "br", "style.css", ""},
+		{"/static/style.css", "br, gzip", "style.css.gz", "gzip"},
+		{"/static/plain.txt", "br, gzip", "plain.txt", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != test.body ||
+			w.Header().Get("Content-Encoding") != test.encoding || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("serving %s with %q failed: Code=%d, Body=%q, Header=%v",
+				test.path, test.accept, w.Code, w.Body.String(), w.Header())
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/static/app.js", nil)
+	r.Header.Set("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if ctype := w.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "text/javascript") {
+		t.Errorf("Wrong Content-Type of the precompressed file: %q", ctype)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// RouteGroup is a group of routes sharing a common path prefix and,
+// optionally, a common stack of http.Handler middleware.
+type RouteGroup struct {
+	r          *Router
+	p          string
+	middleware []func(http.Handler) http.Handler
+	version    string
+}
+
+// NewGroup returns a new RouteGroup. All routes registered with the group
+// are prefixed with the given path.
+func (r *Router) NewGroup(path string) *RouteGroup {
+	return newRouteGroup(r, path)
+}
+
+func newRouteGroup(r *Router, path string) *RouteGroup {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+
+	// Strip trailing / (if present) as all added sub paths must start with a /
+	if path[len(path)-1] == '/' {
+		path = path[:len(path)-1]
+	}
+
+	return &RouteGroup{r: r, p: path}
+}
+
+// Version returns a new RouteGroup with the prefix "/v" followed by the given
+// version, e.g. /v2 for the version "2". The version is stored in the request
+// context of all routes of the group and its sub groups, see APIVersion.
+func (r *Router) Version(v string) *RouteGroup {
+	g := newRouteGroup(r, "/v"+v)
+	g.version = v
+	return g
+}
+
+type versionKey struct{}
+
+// APIVersion returns the version of the RouteGroup created with
+// Router.Version, the matched route of the request belongs to. If the route
+// does not belong to such a group, an empty string is returned.
+// The version is also available to the middleware of the router.
+func APIVersion(r *http.Request) string {
+	v, _ := r.Context().Value(versionKey{}).(string)
+	return v
+}
+
+// withVersion stores the given version in the request context.
+func withVersion(v string, handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		handle(w, req.WithContext(context.WithValue(req.Context(), versionKey{}, v)), ps)
+	}
+}
+
+// NewGroup returns a new RouteGroup, whose prefix is the prefix of this group
+// followed by the given path. The new group inherits the middleware and the
+// version of this group.
+func (g *RouteGroup) NewGroup(path string) *RouteGroup {
+	sub := newRouteGroup(g.r, g.subPath(path))
+	sub.middleware = g.middleware
+	sub.version = g.version
+	return sub
+}
+
+// With returns a new RouteGroup with the same prefix as this group, whose
+// routes are additionally wrapped by the given net/http style middleware.
+// The middleware passed first is the outermost one.
+// The path parameters are available to the middleware and the wrapped handle
+// via the request context, see ParamsFromContext. The group itself is not
+// modified.
+func (g *RouteGroup) With(middleware ...func(http.Handler) http.Handler) *RouteGroup {
+	mw := make([]func(http.Handler) http.Handler, 0, len(g.middleware)+len(middleware))
+	mw = append(mw, g.middleware...)
+	mw = append(mw, middleware...)
+	return &RouteGroup{r: g.r, p: g.p, middleware: mw, version: g.version}
+}
+
+func (g *RouteGroup) subPath(path string) string {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	return g.p + path
+}
+
+// wrap applies the middleware of the group to the given handle.
+func (g *RouteGroup) wrap(handle Handle) Handle {
+	if len(g.middleware) == 0 {
+		return handle
+	}
+
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handle(w, req, ParamsFromContext(req.Context(), g.r.paramsKey()))
+	})
+	for i := len(g.middleware) - 1; i >= 0; i-- {
+		h = g.middleware[i](h)
+	}
+
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		if len(ps) > 0 {
+			req = req.WithContext(g.r.withParams(req.Context(), ps))
+		}
+		h.ServeHTTP(w, req)
+	}
+}
+
+// Handle registers a new request handle with the given path, prefixed by the
+// prefix of the group, and method. See Router.Handle.
+func (g *RouteGroup) Handle(method, path string, handle Handle) {
+	g.HandleR(method, path, handle)
+}
+
+// HandleR is like Handle, but returns the registered Route, see
+// Router.HandleR.
+func (g *RouteGroup) HandleR(method, path string, handle Handle) *Route {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	route := g.r.HandleR(method, g.subPath(path), g.wrap(handle))
+	if g.version != "" {
+		route.version = g.version
+		route.update()
+	}
+	return route
+}
+
+// Handler is an adapter which allows the usage of an http.Handler as a
+// request handle. See Router.Handler.
+func (g *RouteGroup) Handler(method, path string, handler http.Handler) {
+	g.HandlerR(method, path, handler)
+}
+
+// HandlerR is like Handler, but returns the registered Route, see
+// Router.HandleR.
+func (g *RouteGroup) HandlerR(method, path string, handler http.Handler) *Route {
+	return g.HandleR(method, path,
+		func(w http.ResponseWriter, req *http.Request, p Params) {
+			if len(p) > 0 {
+				req = req.WithContext(g.r.withParams(req.Context(), p))
+			}
+			handler.ServeHTTP(w, req)
+		},
+	)
+}
+
+// HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
+// request handle.
+func (g *RouteGroup) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	g.HandlerR(method, path, handler)
+}
+
+// HandlerFuncR is like HandlerFunc, but returns the registered Route, see
+// Router.HandleR.
+func (g *RouteGroup) HandlerFuncR(method, path string, handler http.HandlerFunc) *Route {
+	return g.HandlerR(method, path, handler)
+}
+
+// GET is a shortcut for group.Handle(http.MethodGet, path, handle)
+func (g *RouteGroup) GET(path string, handle Handle) {
+	g.HandleR(http.MethodGet, path, handle)
+}
+
+// GETR is a shortcut for group.HandleR(http.MethodGet, path, handle)
+func (g *RouteGroup) GETR(path string, handle Handle) *Route {
+	return g.HandleR(http.MethodGet, path, handle)
+}
+
+// HEAD is a shortcut for group.Handle(http.MethodHead, path, handle)
+func (g *RouteGroup) HEAD(path string, handle Handle) {
+	g.HandleR(http.MethodHead, path, handle)
+}
+
+// HEADR is a shortcut for group.HandleR(http.MethodHead, path, handle)
+func (g *RouteGroup) HEADR(path string, handle Handle) *Route {
+	return g.HandleR(http.MethodHead, path, handle)
+}
+
+// OPTIONS is a shortcut for group.Handle(http.MethodOptions, path, handle)
+func (g *RouteGroup) OPTIONS(path string, handle Handle) {
+	g.HandleR(http.MethodOptions, path, handle)
+}
+
+// OPTIONSR is a shortcut for group.HandleR(http.MethodOptions, path, handle)
+func (g *RouteGroup) OPTIONSR(path string, handle Handle) *Route {
+	return g.HandleR(http.MethodOptions, path, handle)
+}
+
+// POST is a shortcut for group.Handle(http.MethodPost, path, handle)
+func (g *RouteGroup) POST(path string, handle Handle) {
+	g.HandleR(http.MethodPost, path, handle)
+}
+
+// POSTR is a shortcut for group.HandleR(http.MethodPost, path, handle)
+func (g *RouteGroup) POSTR(path string, handle Handle) *Route {
+	return g.HandleR(http.MethodPost, path, handle)
+}
+
+// PUT is a shortcut for group.Handle(http.MethodPut, path, handle)
+func (g *RouteGroup) PUT(path string, handle Handle) {
+	g.HandleR(http.MethodPut, path, handle)
+}
+
+// PUTR is a shortcut for group.HandleR(http.MethodPut, path, handle)
+func (g *RouteGroup) PUTR(path string, handle Handle) *Route {
+	return g.HandleR(http.MethodPut, path, handle)
+}
+
+// PATCH is a shortcut for group.Handle(http.MethodPatch, path, handle)
+func (g *RouteGroup) PATCH(path string, handle Handle) {
+	g.HandleR(http.MethodPatch, path, handle)
+}
+
+// PATCHR is a shortcut for group.HandleR(http.MethodPatch, path, handle)
+func (g *RouteGroup) PATCHR(path string, handle Handle) *Route {
+	return g.HandleR(http.MethodPatch, path, handle)
+}
+
+// DELETE is a shortcut for group.Handle(http.MethodDelete, path, handle)
+func (g *RouteGroup) DELETE(path string, handle Handle) {
+	g.HandleR(http.MethodDelete, path, handle)
+}
+
+// DELETER is a shortcut for group.HandleR(http.MethodDelete, path, handle)
+func (g *RouteGroup) DELETER(path string, handle Handle) *Route {
+	return g.HandleR(http.MethodDelete, path, handle)
+}
+
+// MethodGroup registers routes for several methods at once, with the prefix
+// of the RouteGroup it was created by, see RouteGroup.Methods.
+type MethodGroup struct {
+	g       *RouteGroup
+	methods []string
+}
+
+// Methods returns a MethodGroup, which registers each route for all given
+// methods, e.g. g.Methods(http.MethodGet, http.MethodPost).Handle("/x", h).
+func (g *RouteGroup) Methods(methods ...string) *MethodGroup {
+	if len(methods) == 0 {
+		panic("methods must not be empty")
+	}
+	return &MethodGroup{g: g, methods: append([]string(nil), methods...)}
+}
+
+// Handle registers the handle with the given path, prefixed by the prefix of
+// the group, for all methods of the group. It returns the routes in the order
+// of the methods. If the registration fails for a method, the panic reports
+// the method.
+func (mg *MethodGroup) Handle(path string, handle Handle) []*Route {
+	routes := make([]*Route, len(mg.methods))
+	for i, method := range mg.methods {
+		routes[i] = mg.handle(method, path, handle)
+	}
+	return routes
+}
+
+func (mg *MethodGroup) handle(method, path string, handle Handle) *Route {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			panic(fmt.Sprintf("%v for method %s", rcv, method))
+		}
+	}()
+	return mg.g.HandleR(method, path, handle)
+}
+
+// Handler is an adapter which allows the usage of an http.Handler as a
+// request handle for all methods of the group. See RouteGroup.Handler.
+func (mg *MethodGroup) Handler(path string, handler http.Handler) []*Route {
+	return mg.Handle(path,
+		func(w http.ResponseWriter, req *http.Request, p Params) {
+			if len(p) > 0 {
+				req = req.WithContext(mg.g.r.withParams(req.Context(), p))
+			}
+			handler.ServeHTTP(w, req)
+		},
+	)
+}
+
+// HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
+// request handle for all methods of the group.
+func (mg *MethodGroup) HandlerFunc(path string, handler http.HandlerFunc) []*Route {
+	return mg.Handler(path, handler)
+}
@@ -0,0 +1,204 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouteGroupAPI(t *testing.T) {
+	var get, head, options, post, put, patch, delete, handler, handlerFunc bool
+
+	httpHandler := handlerStruct{&handler}
+
+	router := New()
+	group := router.NewGroup("/foo/") // trailing slash is stripped
+	group.GET("/GET", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		get = true
+	})
+	group.HEAD("/GET", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		head = true
+	})
+	group.OPTIONS("/GET", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		options = true
+	})
+	group.POST("/POST", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		post = true
+	})
+	group.PUT("/PUT", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		put = true
+	})
+	group.PATCH("/PATCH", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		patch = true
+	})
+	group.DELETE("/DELETE", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		delete = true
+	})
+	group.Handler(http.MethodGet, "/Handler", httpHandler)
+	group.HandlerFunc(http.MethodGet, "/HandlerFunc", func(w http.ResponseWriter, r *http.Request) {
+		handlerFunc = true
+	})
+
+	testRoutes := []struct {
+		method string
+		route  string
+		routed *bool
+	}{
+		{http.MethodGet, "/foo/GET", &get},
+		{http.MethodHead, "/foo/GET", &head},
+		{http.MethodOptions, "/foo/GET", &options},
+		{http.MethodPost, "/foo/POST", &post},
+		{http.MethodPut, "/foo/PUT", &put},
+		{http.MethodPatch, "/foo/PATCH", &patch},
+		{http.MethodDelete, "/foo/DELETE", &delete},
+		{http.MethodGet, "/foo/Handler", &handler},
+		{http.MethodGet, "/foo/HandlerFunc", &handlerFunc},
+	}
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(tr.method, tr.route, nil)
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if !*tr.routed {
+			t.Errorf("routing %s %s failed", tr.method, tr.route)
+		}
+	}
+}
+
+func TestRouteGroupInvalidInput(t *testing.T) {
+	router := New()
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	recv := catchPanic(func() {
+		router.NewGroup("noSlashRoot")
+	})
+	if recv == nil {
+		t.Fatal("creating group with path not beginning with '/' did not panic")
+	}
+
+	recv = catchPanic(func() {
+		router.NewGroup("/foo").GET("noSlashRoot", handle)
+	})
+	if recv == nil {
+		t.Fatal("registering path not beginning with '/' did not panic")
+	}
+
+	recv = catchPanic(func() {
+		router.NewGroup("/foo").GET("/", nil)
+	})
+	if recv == nil {
+		t.Fatal("registering nil handler did not panic")
+	}
+}
+
+func TestRouteGroupWith(t *testing.T) {
+	var calls []string
+	record := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls = append(calls, name+":"+ParamsFromContext(req.Context()).ByName("name"))
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+
+	router := New()
+	api := router.NewGroup("/api")
+	v1 := api.With(record("outer")).NewGroup("/v1").With(record("inner"))
+	v1.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		calls = append(calls, "handle:"+ps.ByName("name"))
+	})
+	api.GET("/plain", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		calls = append(calls, "plain")
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/api/v1/user/gopher", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if want := []string{"outer:gopher", "inner:gopher", "handle:gopher"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("Wrong calls: want %v, got %v", want, calls)
+	}
+
+	// the parent group is not affected by With
+	calls = nil
+	r, _ = http.NewRequest(http.MethodGet, "/api/plain", nil)
+	router.ServeHTTP(w, r)
+	if want := []string{"plain"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("Wrong calls: want %v, got %v", want, calls)
+	}
+}
+
+func TestRouteGroupMethods(t *testing.T) {
+	var methods []string
+	router := New()
+	group := router.NewGroup("/api")
+	routes := group.Methods(http.MethodGet, http.MethodPost).Handle("/x", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		methods = append(methods, r.Method)
+	})
+	if len(routes) != 2 || routes[0].Method() != http.MethodGet || routes[1].Method() != http.MethodPost || routes[1].Path() != "/api/x" {
+		t.Fatalf("Wrong routes: %v", routes)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut} {
+		r, _ := http.NewRequest(method, "/api/x", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if want := []string{http.MethodGet, http.MethodPost}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("Wrong methods routed: want %v, got %v", want, methods)
+	}
+
+	// conflicts are reported per method
+	recv := catchPanic(func() {
+		group.Methods(http.MethodPut, http.MethodPost).HandlerFunc("/x", func(_ http.ResponseWriter, _ *http.Request) {})
+	})
+	if msg, _ := recv.(string); msg != "a handle is already registered for path '/api/x' for method POST" {
+		t.Errorf("Unexpected panic: %v", recv)
+	}
+
+	recv = catchPanic(func() {
+		group.Methods()
+	})
+	if recv == nil {
+		t.Error("creating a MethodGroup without methods did not panic")
+	}
+}
+
+func TestRouterVersion(t *testing.T) {
+	var version, mwVersion string
+	router := New()
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			mwVersion = APIVersion(r)
+			next(w, r, ps)
+		}
+	})
+	handle := func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		version = APIVersion(r)
+	}
+	router.Version("2").NewGroup("/users").GET("/:id", handle)
+	router.Version("1").With(func(next http.Handler) http.Handler {
+		return next
+	}).GET("/users/:id", handle)
+	router.GET("/users/:id", handle)
+
+	tests := []struct {
+		route   string
+		version string
+	}{
+		{"/v2/users/1", "2"},
+		{"/v1/users/1", "1"},
+		{"/users/1", ""},
+	}
+	for _, test := range tests {
+		version, mwVersion = "-", "-"
+		r, _ := http.NewRequest(http.MethodGet, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || version != test.version || mwVersion != test.version {
+			t.Errorf("Wrong version for %s: want %q, got %q (middleware %q), Code=%d", test.route, test.version, version, mwVersion, w.Code)
+		}
+	}
+}
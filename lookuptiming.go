@@ -0,0 +1,44 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"sync"
+	"time"
+)
+
+// lookupTimingsSize is the number of lookup durations the router keeps.
+const lookupTimingsSize = 1024
+
+// lookupTimings is a ring buffer of the durations of the latest lookups.
+type lookupTimings struct {
+	mu   sync.Mutex
+	buf  []time.Duration
+	next int
+}
+
+func (lt *lookupTimings) add(d time.Duration) {
+	lt.mu.Lock()
+	if len(lt.buf) < lookupTimingsSize {
+		lt.buf = append(lt.buf, d)
+	} else {
+		lt.buf[lt.next] = d
+		lt.next = (lt.next + 1) % lookupTimingsSize
+	}
+	lt.mu.Unlock()
+}
+
+// LookupTimings returns the durations of the lookups of the latest requests in
+// the tree, oldest first, if EnableLookupTiming is set. At most the last 1024
+// durations are kept.
+func (r *Router) LookupTimings() []time.Duration {
+	lt := &r.lookupTimings
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	timings := make([]time.Duration, 0, len(lt.buf))
+	timings = append(timings, lt.buf[lt.next:]...)
+	return append(timings, lt.buf[:lt.next]...)
+}
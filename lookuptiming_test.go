@@ -0,0 +1,52 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterLookupTimings(t *testing.T) {
+	router := New()
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	serve := func(n int) {
+		for i := 0; i < n; i++ {
+			r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+			router.ServeHTTP(httptest.NewRecorder(), r)
+		}
+	}
+
+	serve(1)
+	if timings := router.LookupTimings(); len(timings) != 0 {
+		t.Errorf("Timings recorded although disabled: %v", timings)
+	}
+
+	router.EnableLookupTiming = true
+	serve(1)
+	timings := router.LookupTimings()
+	if len(timings) != 1 {
+		t.Fatalf("Wrong number of timings: want 1, got %d", len(timings))
+	}
+	if timings[0] < 0 || timings[0] >= 10*time.Millisecond {
+		t.Errorf("Timing includes the handle: %v", timings[0])
+	}
+
+	// the buffer keeps the latest durations, oldest first
+	router.lookupTimings.add(-1)
+	for i := 0; i < lookupTimingsSize-1; i++ {
+		router.lookupTimings.add(time.Duration(i))
+	}
+	timings = router.LookupTimings()
+	if len(timings) != lookupTimingsSize || timings[0] != -1 || timings[len(timings)-1] != lookupTimingsSize-2 {
+		t.Errorf("Wrong timings in a full buffer: len %d, first %v, last %v",
+			len(timings), timings[0], timings[len(timings)-1])
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover returns a middleware, which recovers from panics in the wrapped
+// handle. The panic is logged using the log package and the request is
+// answered with 500 Internal Server Error.
+// If the handle already wrote the response header, the status can not be
+// changed anymore. The response is then aborted by panicking with
+// http.ErrAbortHandler, instead of completing a possibly partial response.
+// Panics with http.ErrAbortHandler are not recovered.
+//
+// Unlike Router.PanicHandler, the middleware can be combined with other
+// middleware via Router.Use. Middleware added before Recover is not covered.
+func Recover() func(Handle) Handle {
+	return recoverWith(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+	})
+}
+
+// Recover is like the function Recover, but answers with the error page of
+// the router for 500 Internal Server Error, see Router.ErrorPage.
+func (r *Router) Recover() func(Handle) Handle {
+	return recoverWith(func(w http.ResponseWriter, req *http.Request) {
+		r.Error(w, req, http.StatusInternalServerError)
+	})
+}
+
+func recoverWith(reply func(http.ResponseWriter, *http.Request)) func(Handle) Handle {
+	return func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			rw, ok := w.(*responseWriter)
+			if !ok {
+				rw = &responseWriter{ResponseWriter: w}
+			}
+			defer func() {
+				if rcv := recover(); rcv != nil {
+					if rcv == http.ErrAbortHandler {
+						panic(rcv)
+					}
+					log.Printf("httprouter: panic serving %s %s: %v\n%s",
+						req.Method, req.URL.Path, rcv, debug.Stack())
+					if rw.Written() {
+						panic(http.ErrAbortHandler)
+					}
+					reply(w, req)
+				}
+			}()
+			next(rw, req, ps)
+		}
+	}
+}
+
+// Abort replies to the request with the given status code and its status text
+// as plain text, like http.Error. It is meant for middleware which
+// short-circuits a request instead of calling the next handle, see
+// Router.Use.
+func Abort(w http.ResponseWriter, code int) {
+	http.Error(w, http.StatusText(code), code)
+}
+
+// RequestIDHeader is the header from which RequestID reads the request ID
+// and to which it writes it.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID returns a middleware, which assigns an ID to each request.
+// The ID is taken from the RequestIDHeader of the request, if present.
+// Otherwise a new random ID is generated.
+// The ID is set as the RequestIDHeader of the response and stored in the
+// request context, see RequestIDFromContext.
+func RequestID() func(Handle) Handle {
+	return func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			id := req.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id))
+			next(w, req, ps)
+		}
+	}
+}
+
+// RequestIDFromContext returns the request ID stored in the context by
+// RequestID, or an empty string if none is present.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
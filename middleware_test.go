@@ -0,0 +1,261 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	router := New()
+	router.Use(Recover())
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/panic", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Panic recovery failed: Code=%d", w.Code)
+	}
+
+	recv := catchPanic(func() {
+		Recover()(func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			panic(http.ErrAbortHandler)
+		})(httptest.NewRecorder(), r, nil)
+	})
+	if recv != http.ErrAbortHandler {
+		t.Errorf("http.ErrAbortHandler was recovered: %v", recv)
+	}
+
+	// the response can not be changed after the header was written
+	w = httptest.NewRecorder()
+	recv = catchPanic(func() {
+		Recover()(func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			w.Write([]byte("partial"))
+			panic("oops!")
+		})(w, r, nil)
+	})
+	if recv != http.ErrAbortHandler {
+		t.Errorf("Response was not aborted: %v", recv)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("Response was modified after the panic: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestRouterRecover(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	router := New()
+	router.ErrorPage(http.StatusInternalServerError, func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "<h1>oops</h1>")
+	})
+	router.Use(router.Recover())
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/panic", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "<h1>oops</h1>" {
+		t.Errorf("Error page was not used: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var id string
+	router := New()
+	router.Use(RequestID())
+	router.GET("/", func(_ http.ResponseWriter, req *http.Request, _ Params) {
+		id = RequestIDFromContext(req.Context())
+	})
+
+	// propagate
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if id != "abc" || w.Header().Get(RequestIDHeader) != "abc" {
+		t.Errorf("Request ID propagation failed: context=%q, header=%q", id, w.Header().Get(RequestIDHeader))
+	}
+
+	// generate
+	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if id == "" || id == "abc" || w.Header().Get(RequestIDHeader) != id {
+		t.Errorf("Request ID generation failed: context=%q, header=%q", id, w.Header().Get(RequestIDHeader))
+	}
+
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		t.Errorf("Got request ID from empty context: %q", id)
+	}
+}
+
+func TestRouterUse(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var calls []string
+	record := func(name string) func(Handle) Handle {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, req *http.Request, ps Params) {
+				calls = append(calls, name+":"+RequestIDFromContext(req.Context()))
+				next(w, req, ps)
+			}
+		}
+	}
+
+	router := New()
+	router.GET("/before", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.Use(record("first"), RequestID())
+	router.Use(Recover(), record("second"))
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		calls = append(calls, "handle:"+ps.ByName("name"))
+		panic("oops!")
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Panic recovery failed: Code=%d", w.Code)
+	}
+	if want := []string{"first:", "second:abc", "handle:gopher"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("Wrong middleware order: want %v, got %v", want, calls)
+	}
+
+	// handles registered before Use are not wrapped
+	calls = nil
+	r, _ = http.NewRequest(http.MethodGet, "/before", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if len(calls) != 0 {
+		t.Errorf("Middleware applied to previously registered handle: %v", calls)
+	}
+}
+
+func TestRouterDecorate(t *testing.T) {
+	var calls []string
+	record := func(name string) func(Handle) Handle {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, req *http.Request, ps Params) {
+				calls = append(calls, name)
+				next(w, req, ps)
+			}
+		}
+	}
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		calls = append(calls, "handle")
+	}
+	isAdmin := func(_, path string) bool {
+		return strings.HasPrefix(path, "/admin/")
+	}
+
+	router := New()
+	router.Use(record("use"))
+	router.GET("/admin/users", handle)
+	router.GET("/public", handle)
+	router.Decorate(isAdmin, record("admin"))
+	router.Decorate(func(method, _ string) bool {
+		return method == http.MethodPost
+	}, record("post"))
+	router.POST("/admin/users", handle)
+
+	tests := []struct {
+		method string
+		route  string
+		calls  []string
+	}{
+		{http.MethodGet, "/admin/users", []string{"use", "admin", "handle"}},
+		{http.MethodPost, "/admin/users", []string{"use", "admin", "post", "handle"}},
+		{http.MethodGet, "/public", []string{"use", "handle"}},
+	}
+	for _, test := range tests {
+		calls = nil
+		r, _ := http.NewRequest(test.method, test.route, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("Wrong calls for %s %s: want %v, got %v", test.method, test.route, test.calls, calls)
+		}
+	}
+}
+
+func TestRouterUseFor(t *testing.T) {
+	var authorized []string
+	auth := func(next Handle) Handle {
+		return func(w http.ResponseWriter, req *http.Request, ps Params) {
+			authorized = append(authorized, req.URL.Path)
+			next(w, req, ps)
+		}
+	}
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/admin/users", handle)
+	router.GET("/administrator", handle)
+	router.GET("/public", handle)
+	router.UseFor("/admin/", auth)
+	router.GET("/admin/settings/*rest", handle)
+
+	for _, path := range []string{"/admin/users", "/administrator", "/public", "/admin/settings/x"} {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if want := []string{"/admin/users", "/admin/settings/x"}; !reflect.DeepEqual(authorized, want) {
+		t.Errorf("Wrong paths wrapped: want %v, got %v", want, authorized)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	var buf strings.Builder
+	var routed bool
+	router := New()
+	router.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			if r.Header.Get("Authorization") == "" {
+				Abort(w, http.StatusUnauthorized)
+				return
+			}
+			next(w, r, ps)
+		}
+	})
+	router.GET("/private", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/private", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if routed || w.Code != http.StatusUnauthorized || w.Body.String() != "Unauthorized\n" {
+		t.Errorf("Request was not aborted: routed=%v, Code=%d, Body=%q", routed, w.Code, w.Body.String())
+	}
+	if !strings.Contains(buf.String(), "route=/private status=401") {
+		t.Errorf("Aborted request was not logged with its status: %s", buf.String())
+	}
+
+	buf.Reset()
+	r.Header.Set("Authorization", "Bearer token")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !routed || !strings.Contains(buf.String(), "status=200") {
+		t.Errorf("Authorized request failed: routed=%v, log %s", routed, buf.String())
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// muxMethods are the methods for which patterns without a method are
+// registered by RouterFromPatterns.
+var muxMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// RouterFromPatterns returns a new Router, see New, with routes for the given
+// patterns in the syntax of http.ServeMux, which eases the migration from it:
+//   - a pattern may begin with a method, e.g. "GET /index.html", otherwise
+//     the route is registered for the methods GET, HEAD, POST, PUT, PATCH,
+//     DELETE and OPTIONS
+//   - a pattern ending with a slash matches the subtree below it and is
+//     translated to a catch-all route, e.g. /static/ to /static/*rest
+//   - the pattern "/", which matches all requests in a http.ServeMux, is
+//     registered as fallback, see Router.Any. With a method, e.g. "GET /",
+//     it handles the requests of the method no route matches, see
+//     Router.NotFound
+//
+// Unlike in a http.ServeMux, patterns must not overlap, e.g. /files/ and
+// /files/index.html, since the router matches each path with at most one
+// route; RouterFromPatterns panics for them. Hosts and wildcards in patterns
+// are not supported.
+func RouterFromPatterns(patterns map[string]http.Handler) *Router {
+	keys := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		keys = append(keys, pattern)
+	}
+	sort.Strings(keys)
+
+	r := New()
+	var anyRoot http.Handler
+	var methodRoots map[string]http.Handler
+	for _, pattern := range keys {
+		handler := patterns[pattern]
+		methods := muxMethods
+		path := pattern
+		if method, p, found := strings.Cut(pattern, " "); found {
+			methods = []string{method}
+			path = strings.TrimLeft(p, " ")
+		}
+		if len(path) < 1 || path[0] != '/' {
+			panic("pattern must begin with '/' in pattern '" + pattern + "'")
+		}
+		if strings.ContainsAny(path, "{}") {
+			panic("wildcards are not supported in pattern '" + pattern + "'")
+		}
+
+		if path == "/" {
+			if len(methods) == len(muxMethods) {
+				anyRoot = handler
+				continue
+			}
+			if methodRoots == nil {
+				methodRoots = make(map[string]http.Handler)
+			}
+			methodRoots[methods[0]] = handler
+			continue
+		}
+
+		// Escape wildcard characters of the router
+		path = strings.NewReplacer(":", "::", "*", "\\*").Replace(path)
+		if strings.HasSuffix(path, "/") {
+			path += "*rest"
+		}
+		for _, method := range methods {
+			r.Handler(method, path, handler)
+		}
+	}
+
+	switch {
+	case anyRoot != nil:
+		r.Any(func(w http.ResponseWriter, req *http.Request, _ Params) {
+			if h := methodRoots[req.Method]; h != nil {
+				h.ServeHTTP(w, req)
+				return
+			}
+			anyRoot.ServeHTTP(w, req)
+		})
+	case methodRoots != nil:
+		r.NotFound = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if h := methodRoots[req.Method]; h != nil {
+				h.ServeHTTP(w, req)
+				return
+			}
+			http.NotFound(w, req)
+		})
+	}
+	return r
+}
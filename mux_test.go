@@ -0,0 +1,90 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterFromPatterns(t *testing.T) {
+	handler := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(body))
+		})
+	}
+	router := RouterFromPatterns(map[string]http.Handler{
+		"/":                handler("root"),
+		"/about":           handler("about"),
+		"/static/":         handler("static"),
+		"POST /api/submit": handler("submit"),
+		"/time:now":        handler("colon"),
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/about", http.StatusOK, "about"},
+		{http.MethodDelete, "/about", http.StatusOK, "about"},
+		{http.MethodGet, "/static/", http.StatusOK, "static"},
+		{http.MethodGet, "/static/css/site.css", http.StatusOK, "static"},
+		{http.MethodGet, "/static", http.StatusMovedPermanently, ""},
+		{http.MethodPost, "/api/submit", http.StatusOK, "submit"},
+		{http.MethodGet, "/api/submit", http.StatusOK, "root"},
+		{http.MethodGet, "/time:now", http.StatusOK, "colon"},
+		{http.MethodGet, "/unknown", http.StatusOK, "root"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("Wrong response for %s %s: want %d %q, got %d %q",
+				test.method, test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	// a root with a method handles the unmatched requests of the method
+	router = RouterFromPatterns(map[string]http.Handler{
+		"GET /":     handler("root"),
+		"GET /api/": handler("api"),
+	})
+	tests = []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/", http.StatusOK, "root"},
+		{http.MethodGet, "/unknown", http.StatusOK, "root"},
+		{http.MethodGet, "/api/users", http.StatusOK, "api"},
+		{http.MethodPost, "/unknown", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("Wrong response for %s %s: want %d %q, got %d %q",
+				test.method, test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	for _, patterns := range []map[string]http.Handler{
+		{"/files/": handler(""), "/files/index.html": handler("")},
+		{"/items/{id}": handler("")},
+		{"example.com/": handler("")},
+	} {
+		if recv := catchPanic(func() {
+			RouterFromPatterns(patterns)
+		}); recv == nil {
+			t.Errorf("no panic for patterns %v", patterns)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HandlePattern registers a new request handle with the given method and a
+// path template in the syntax of gRPC HTTP annotations, as used by
+// gRPC-gateway, e.g. /v1/{name=projects/*/books/*}. The template is
+// translated to a path of the router and the handle receives the values of
+// the variables of the template as Params, e.g. the Param "name" with the value
+// "projects/p1/books/b1" for the request /v1/projects/p1/books/b1.
+//
+// The following features of templates are supported:
+//   - literal segments, e.g. /v1/shelves
+//   - variables matching a single segment, e.g. {shelf} or {shelf=*}
+//   - variables matching a template of literal segments and '*', optionally
+//     ending with '**' which matches the rest of the path,
+//     e.g. {name=shelves/*/books/**}
+//   - a custom verb after a literal segment, e.g. /v1/shelves:batchGet
+//
+// Anonymous wildcards outside of variables and custom verbs after variables
+// are not supported, since the router matches only one wildcard per path
+// segment. HandlePattern panics for templates using them.
+func (r *Router) HandlePattern(method, pattern string, handle Handle) *Route {
+	path, vars := translatePattern(pattern)
+	if len(vars) > 0 {
+		handle = bindPatternVars(vars, handle)
+	}
+	return r.HandleR(method, path, handle)
+}
+
+// patternVar is a variable of a path template, whose value is assembled from
+// the values of several params, see HandlePattern.
+type patternVar struct {
+	name string
+
+	// The segments of the template of the variable and for each segment the
+	// key of the param holding its value or "" for literal segments.
+	segments []string
+	keys     []string
+}
+
+// translatePattern translates a path template of a gRPC HTTP annotation into
+// a path of the router. The returned variables must be assembled from the
+// params of the path, see bindPatternVars.
+func translatePattern(pattern string) (string, []patternVar) {
+	if len(pattern) < 1 || pattern[0] != '/' {
+		panic("pattern must begin with '/' in pattern '" + pattern + "'")
+	}
+
+	// Split off the custom verb
+	var verb string
+	if i := strings.LastIndexByte(pattern, ':'); i > strings.LastIndexByte(pattern, '/') &&
+		i > strings.LastIndexByte(pattern, '}') {
+		if pattern[i-1] == '}' {
+			panic("custom verbs after variables are not supported in pattern '" + pattern + "'")
+		}
+		pattern, verb = pattern[:i], pattern[i+1:]
+	}
+
+	var path strings.Builder
+	var vars []patternVar
+	for i := 0; i < len(pattern); {
+		switch pattern[i] {
+		case '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				panic("unclosed variable in pattern '" + pattern + "'")
+			}
+			if pattern[i-1] != '/' || (i+end+1 < len(pattern) && pattern[i+end+1] != '/') {
+				panic("variables must span whole path segments in pattern '" + pattern + "'")
+			}
+			if v := translateVar(&path, pattern[i+1:i+end]); v != nil {
+				vars = append(vars, *v)
+			}
+			i += end + 1
+		case '*':
+			panic("wildcards outside of variables are not supported in pattern '" + pattern + "'")
+		case ':':
+			path.WriteString("::")
+			i++
+		default:
+			path.WriteByte(pattern[i])
+			i++
+		}
+	}
+	if verb != "" {
+		path.WriteString("::" + verb)
+	}
+	return path.String(), vars
+}
+
+// translateVar writes the path of the router for the given variable of a path
+// template, e.g. "name=shelves/*", to path. It returns the variable, if its
+// value must be assembled from several params.
+func translateVar(path *strings.Builder, spec string) *patternVar {
+	name, template, found := strings.Cut(spec, "=")
+	if name == "" {
+		panic("variable without name in '{" + spec + "}'")
+	}
+	if !found || template == "*" {
+		path.WriteString(":" + name)
+		return nil
+	}
+
+	v := &patternVar{name: name, segments: strings.Split(template, "/")}
+	v.keys = make([]string, len(v.segments))
+	for i, segment := range v.segments {
+		if i > 0 {
+			path.WriteByte('/')
+		}
+		switch {
+		case segment == "*":
+			v.keys[i] = name + "$" + strconv.Itoa(i)
+			path.WriteString(":" + v.keys[i])
+		case segment == "**":
+			if i < len(v.segments)-1 {
+				panic("'**' must be the last segment in '{" + spec + "}'")
+			}
+			v.keys[i] = name + "$" + strconv.Itoa(i)
+			path.WriteString("*" + v.keys[i])
+		case segment == "" || strings.ContainsAny(segment, "*{}"):
+			panic("invalid segment '" + segment + "' in '{" + spec + "}'")
+		default:
+			path.WriteString(strings.ReplaceAll(segment, ":", "::"))
+		}
+	}
+	return v
+}
+
+// bindPatternVars assembles the values of the given variables from the params
+// of the translated path before the handle is called, see HandlePattern.
+func bindPatternVars(vars []patternVar, handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		bound := make(Params, 0, len(ps))
+		for _, p := range ps {
+			if !strings.Contains(p.Key, "$") || p.Key == MatchedRoutePathParam {
+				bound = append(bound, p)
+			}
+		}
+
+		var value strings.Builder
+		for _, v := range vars {
+			value.Reset()
+			for i, segment := range v.segments {
+				if i > 0 && segment != "**" {
+					value.WriteByte('/')
+				}
+				switch {
+				case v.keys[i] == "":
+					value.WriteString(segment)
+				case segment == "**" && i == 0:
+					// The value of a catch-all param begins with '/'
+					value.WriteString(strings.TrimPrefix(ps.ByName(v.keys[i]), "/"))
+				default:
+					value.WriteString(ps.ByName(v.keys[i]))
+				}
+			}
+			bound = append(bound, Param{Key: v.name, Value: value.String()})
+		}
+		handle(w, req, bound)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTranslatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+	}{
+		{"/v1/shelves", "/v1/shelves"},
+		{"/v1/shelves/{shelf}", "/v1/shelves/:shelf"},
+		{"/v1/shelves/{shelf=*}/books/{book}", "/v1/shelves/:shelf/books/:book"},
+		{"/v1/{name=projects/*}", "/v1/projects/:name$1"},
+		{"/v1/{name=shelves/*/books/*}", "/v1/shelves/:name$1/books/:name$3"},
+		{"/v1/{name=files/**}", "/v1/files/*name$1"},
+		{"/v1/{path=**}", "/v1/*path$0"},
+		{"/v1/shelves:batchGet", "/v1/shelves::batchGet"},
+	}
+	for _, test := range tests {
+		if path, _ := translatePattern(test.pattern); path != test.path {
+			t.Errorf("Wrong translation of %s: want %s, got %s", test.pattern, test.path, path)
+		}
+	}
+
+	for _, pattern := range []string{
+		"v1/shelves",
+		"/v1/*/books",
+		"/v1/{name=projects/*}:cancel",
+		"/v1/{name=**/books}",
+		"/v1/shelf-{shelf}",
+		"/v1/{shelf",
+	} {
+		if recv := catchPanic(func() {
+			translatePattern(pattern)
+		}); recv == nil {
+			t.Errorf("no panic for unsupported pattern %s", pattern)
+		}
+	}
+}
+
+func TestRouterHandlePattern(t *testing.T) {
+	router := New()
+
+	var got Params
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		got = append(Params(nil), ps...)
+	}
+	router.HandlePattern(http.MethodGet, "/v1/shelves/{shelf}/books/{book}", handle)
+	router.HandlePattern(http.MethodGet, "/v1/{name=projects/*/books/*}", handle)
+	router.HandlePattern(http.MethodGet, "/v1/{name=projects/*/locations/*}", handle)
+	router.HandlePattern(http.MethodGet, "/v1/{name=files/**}", handle)
+	router.HandlePattern(http.MethodPost, "/v1/{path=**}", handle)
+	router.HandlePattern(http.MethodPost, "/v2/shelves:batchGet", handle)
+
+	tests := []struct {
+		method string
+		path   string
+		want   Params
+	}{
+		{http.MethodGet, "/v1/shelves/s1/books/b1", Params{{"shelf", "s1"}, {"book", "b1"}}},
+		{http.MethodGet, "/v1/projects/p1/books/b1", Params{{"name", "projects/p1/books/b1"}}},
+		{http.MethodGet, "/v1/projects/p1/locations/l1", Params{{"name", "projects/p1/locations/l1"}}},
+		{http.MethodGet, "/v1/files/a/b.txt", Params{{"name", "files/a/b.txt"}}},
+		{http.MethodPost, "/v1/a/b", Params{{"path", "a/b"}}},
+		{http.MethodPost, "/v2/shelves:batchGet", nil},
+	}
+	for _, test := range tests {
+		got = Params{{"unset", ""}}
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Wrong params for %s %s: want %v, got %d %v", test.method, test.path, test.want, w.Code, got)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// responseWriter wraps a http.ResponseWriter and records the status code of
+// the response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Status returns the status code of the response. If no header was written
+// yet, http.StatusOK is returned, as this is what the server sends by default.
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Written reports whether the response header was already written.
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}
+
+// Unwrap returns the wrapped http.ResponseWriter. It is used by
+// http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implements the http.Flusher interface. It is a no-op if the wrapped
+// http.ResponseWriter does not support flushing.
+func (w *responseWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError flushes the response and returns http.ErrNotSupported if the
+// wrapped http.ResponseWriter does not support flushing. It is used by
+// http.ResponseController.
+func (w *responseWriter) FlushError() error {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack implements the http.Hijacker interface.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// ReadFrom implements the io.ReaderFrom interface, so that the wrapped
+// http.ResponseWriter can still send files with sendfile.
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+// Push implements the http.Pusher interface. It returns
+// http.ErrNotSupported if the wrapped http.ResponseWriter does not support
+// HTTP/2 server push.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// headWriter discards the response body written by a GET handle serving a
+// HEAD request, see Router.HeadFallsBackToGet. Like net/http for the GET
+// request, it sets the Content-Length header to the length of a body written
+// at once, if the handle did not set it. Therefore the header is only written
+// once the handle returned, see finish.
+type headWriter struct {
+	http.ResponseWriter
+	code   int
+	length int
+	writes int
+}
+
+func (w *headWriter) WriteHeader(code int) {
+	if code < 200 {
+		// Informational responses are sent right away
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.length += len(p)
+	w.writes++
+	return len(p), nil
+}
+
+// finish writes the response header, if the handle wrote a response.
+func (w *headWriter) finish() {
+	if w.code == 0 {
+		return
+	}
+	header := w.Header()
+	if w.writes == 1 && w.length > 0 && w.code != http.StatusNoContent &&
+		w.code != http.StatusNotModified && header.Get("Content-Length") == "" &&
+		header.Get("Transfer-Encoding") == "" {
+		header.Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter. It is used by
+// http.ResponseController.
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// HeaderWritten reports whether the response header was already written to w,
+// e.g. by a handle which panicked afterwards. A Router.PanicHandler can use it
+// to decide whether an error response can still be sent. Otherwise the status
+// can not be changed anymore and a partial response was possibly sent, so the
+// connection should rather be aborted, e.g. with panic(http.ErrAbortHandler).
+// It reports false if w does not wrap a http.ResponseWriter of the router,
+// which the router passes to the PanicHandler and, if a Logger is set, to
+// handles.
+func HeaderWritten(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case *responseWriter:
+			return rw.Written()
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
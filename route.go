@@ -0,0 +1,410 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Route is a route registered with a Router, as returned by Router.HandleR and
+// its shortcuts. It can be used to configure options of the specific route:
+//  router.GETR("/user/:id", handle).CORS(&httprouter.CORS{...})
+//
+// Like the registration of routes, the configuration is not
+// concurrency-safe and must be done before the router serves requests.
+type Route struct {
+	router *Router
+	method string
+	path   string
+	host   string
+	name   string
+	leaf   *node // node holding the handle in the tree
+
+	// The handle as it was registered and the router options applied to it
+	handle               Handle
+	middleware           []func(Handle) Handle
+	saveMatchedRoutePath bool
+
+	cors     *CORS
+	validate func(Params) error
+	decoders []paramDecoder
+	consumes []string
+	gone     bool
+	noTSR    bool
+	compress bool
+
+	when          func(*http.Request) bool
+	whenAlternate Handle
+
+	methodNotAllowed    http.Handler
+	minCatchAllSegments int
+	version             string
+	timeout             time.Duration
+}
+
+// Method returns the request method of the route.
+func (rt *Route) Method() string {
+	return rt.method
+}
+
+// Path returns the path of the route as it was registered.
+func (rt *Route) Path() string {
+	return rt.path
+}
+
+// Host returns the host of the route, if it was registered with
+// Router.HostHandle, or an empty string otherwise.
+func (rt *Route) Host() string {
+	return rt.host
+}
+
+// Name sets the name of the route, which must be unique within the router.
+// A named route can be looked up with Router.HandlerByName.
+func (rt *Route) Name(name string) *Route {
+	if other := rt.router.names[name]; other != nil && other != rt {
+		panic("name '" + name + "' is already used by the route " + other.method + " " + other.path)
+	}
+	if rt.name != "" {
+		delete(rt.router.names, rt.name)
+	}
+	if rt.router.names == nil {
+		rt.router.names = make(map[string]*Route)
+	}
+	rt.name = name
+	rt.router.names[name] = rt
+	return rt
+}
+
+// Enabled reports whether the route is enabled, see Router.SetEnabled.
+func (rt *Route) Enabled() bool {
+	return !rt.leaf.disabled.Load()
+}
+
+// Gone reports whether the route was registered with Router.Gone.
+func (rt *Route) Gone() bool {
+	return rt.gone
+}
+
+// Validate sets a function which validates the params of each request matched
+// by the route before the handle is called. If it returns an error, the handle
+// is not called and the request is passed to Router.InvalidParams instead.
+// The middleware of the router is applied before the params are validated.
+func (rt *Route) Validate(validate func(Params) error) *Route {
+	rt.validate = validate
+	rt.update()
+	return rt
+}
+
+// When sets a predicate, which is evaluated for each request matched by the
+// route. If it returns true, the request is handled by the alternate handle
+// instead of the registered one, e.g. for canary deployments:
+//  router.GETR("/api/x", a).When(func(r *http.Request) bool {
+//      return r.Header.Get("X-Canary") == "true"
+//  }, b)
+// The options of the route and the middleware of the router apply to both
+// handles. Only one predicate per route is supported, a later call replaces
+// the previous one. Further conditions can be chained by nesting, i.e. with
+// an alternate handle which itself chooses between handles.
+func (rt *Route) When(predicate func(*http.Request) bool, alternate Handle) *Route {
+	if alternate == nil {
+		panic("handle must not be nil")
+	}
+	rt.when = predicate
+	rt.whenAlternate = alternate
+	rt.update()
+	return rt
+}
+
+// Consumes sets the media types of the request body accepted by the route,
+// e.g. "application/json". Requests without a Content-Type header matching
+// one of the types are answered with 415 (Unsupported Media Type), see
+// Router.ErrorPage, before the handle is called. A type may end with the
+// wildcard "/*", e.g. "application/*" accepts all application types.
+// The middleware of the router is applied before the Content-Type is checked.
+func (rt *Route) Consumes(mediaTypes ...string) *Route {
+	rt.consumes = make([]string, len(mediaTypes))
+	for i, t := range mediaTypes {
+		rt.consumes[i] = strings.ToLower(t)
+	}
+	rt.update()
+	return rt
+}
+
+type paramDecoder struct {
+	name   string
+	decode func(string) (interface{}, error)
+}
+
+type decodedParamKey string
+
+// Decode sets a function which decodes the value of the param with the given
+// name of each request matched by the route, e.g. to parse a date once for all
+// middleware and the handle. The decoded value is stored in the request
+// context, see DecodedParam. If the function returns an error, the request is
+// passed to Router.InvalidParams like for Validate.
+// Unlike Validate, the params are decoded before the middleware of the router
+// is applied. It panics if the route has no param with the given name.
+func (rt *Route) Decode(name string, decode func(string) (interface{}, error)) *Route {
+	if !hasParam(rt.path, name) {
+		panic("route '" + rt.path + "' has no param '" + name + "'")
+	}
+	rt.decoders = append(rt.decoders, paramDecoder{name, decode})
+	rt.update()
+	return rt
+}
+
+// DecodedParam returns the value of the param with the given name decoded by
+// the function set with Route.Decode, or nil if no such value is present.
+func DecodedParam(r *http.Request, name string) interface{} {
+	return r.Context().Value(decodedParamKey(name))
+}
+
+// hasParam reports whether the given path has a wildcard with the given name.
+func hasParam(path, name string) bool {
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			return false
+		}
+		if wildcard[1:] == name {
+			return true
+		}
+		path = path[i+len(wildcard):]
+	}
+}
+
+// expandPath replaces the wildcards of the given route path by the values of
+// the params with the same names.
+func expandPath(path string, ps Params) string {
+	var b strings.Builder
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			b.WriteString(unescapePath(path))
+			return b.String()
+		}
+		value := ps.ByName(wildcard[1:])
+		if wildcard[0] == '*' {
+			// The path already has the slash before the catch-all parameter
+			value = strings.TrimPrefix(value, "/")
+		}
+		b.WriteString(unescapePath(path[:i]))
+		b.WriteString(value)
+		path = path[i+len(wildcard):]
+	}
+}
+
+// MinCatchAllSegments sets the minimum number of non-empty path segments the
+// value of the catch-all parameter of the route must have. For example
+// router.GETR("/api/*rest", handle).MinCatchAllSegments(1) does not match
+// /api/, which is then handled like any other path without a matching route.
+// The default is 0, i.e. the catch-all parameter also matches an empty path.
+// It panics if the route has no catch-all parameter.
+func (rt *Route) MinCatchAllSegments(n int) *Route {
+	if rt.leaf.nType != catchAll {
+		panic("route '" + rt.path + "' has no catch-all parameter")
+	}
+	rt.minCatchAllSegments = n
+	return rt
+}
+
+// Compress enables the gzip compression of the responses of the route for
+// clients which accept it according to their Accept-Encoding header, e.g. for
+// large JSON responses. Responses with a body smaller than 1 KiB, with a
+// Content-Encoding or with the type of already compressed content, e.g. an
+// image, are sent uncompressed. The Vary header of all responses of the route
+// contains Accept-Encoding.
+// The middleware of the router is applied before the response is compressed.
+func (rt *Route) Compress() *Route {
+	rt.compress = true
+	rt.update()
+	return rt
+}
+
+// Timeout sets the timeout of the route, which overrides the DefaultTimeout of
+// the router. A timeout of 0 disables the timeout for the route.
+func (rt *Route) Timeout(timeout time.Duration) *Route {
+	rt.timeout = timeout
+	rt.update()
+	return rt
+}
+
+// NoTSR disables the redirects to the route for requests with an added or
+// removed trailing slash, see Router.RedirectTrailingSlash, e.g. for webhooks
+// whose senders would drop the body of a POST request when following the
+// redirect. Such requests are answered like requests to a path without a
+// route instead. This also applies to the trailing slash fixed by
+// Router.RedirectFixedPath.
+func (rt *Route) NoTSR() *Route {
+	rt.noTSR = true
+	return rt
+}
+
+// noTSR reports whether the route matching the given path in the tree has
+// disabled the trailing slash redirect, see Route.NoTSR.
+func noTSR(root *node, path string) bool {
+	leaf, _, _ := root.getValue(path, nil)
+	return leaf != nil && leaf.route != nil && leaf.route.noTSR
+}
+
+// OnMethodNotAllowed sets a handler which is called instead of
+// Router.MethodNotAllowed for requests to the path of the route with a method
+// for which no route is registered, e.g. to suggest the correct method in the
+// body. The "Allow" header is set before the handler is called.
+// If several routes of the path set a handler, the one of the route with the
+// lowest method in the sort order is used.
+func (rt *Route) OnMethodNotAllowed(handler http.Handler) *Route {
+	rt.methodNotAllowed = handler
+	return rt
+}
+
+// methodNotAllowedFor returns the handler set by Route.OnMethodNotAllowed for
+// the given path, or nil if none is set. reqMethod is the method of the request,
+// for which no route matches the path.
+func (r *Router) methodNotAllowedFor(path, reqMethod string) http.Handler {
+	var handler http.Handler
+	var handlerMethod string
+	for method, root := range r.trees {
+		if method == reqMethod || (handler != nil && method > handlerMethod) {
+			continue
+		}
+		leaf, _, _ := root.getValue(path, nil)
+		if leaf != nil && leaf.route != nil && leaf.route.methodNotAllowed != nil {
+			handler = leaf.route.methodNotAllowed
+			handlerMethod = method
+		}
+	}
+	return handler
+}
+
+// compose wraps the registered handle of the route with its options, the
+// matching decorators and the middleware of the router and the handles
+// storing the version and the matched route path.
+func (rt *Route) compose() Handle {
+	handle := rt.handle
+
+	if rt.when != nil {
+		handle = choose(rt.when, rt.whenAlternate, handle)
+	}
+
+	if rt.validate != nil {
+		handle = rt.router.validateParams(rt.validate, handle)
+	}
+
+	if len(rt.consumes) > 0 {
+		handle = rt.router.checkContentType(rt.consumes, handle)
+	}
+
+	if rt.timeout > 0 {
+		handle = rt.router.withTimeout(rt.timeout, handle)
+	}
+
+	if rt.compress {
+		handle = compress(handle)
+	}
+
+	decorators := rt.router.decorators
+	for i := len(decorators) - 1; i >= 0; i-- {
+		if decorators[i].match(rt.method, rt.path) {
+			handle = decorators[i].decorate(handle)
+		}
+	}
+
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		handle = rt.middleware[i](handle)
+	}
+
+	if len(rt.decoders) > 0 {
+		handle = rt.router.decodeParams(rt.decoders, handle)
+	}
+
+	if rt.version != "" {
+		handle = withVersion(rt.version, handle)
+	}
+
+	if rt.saveMatchedRoutePath {
+		handle = rt.router.saveMatchedRoutePath(rt.path, handle)
+	}
+	return handle
+}
+
+// update replaces the handle in the tree after an option of the route changed.
+func (rt *Route) update() {
+	rt.leaf.handle = rt.compose()
+}
+
+func (r *Router) validateParams(validate func(Params) error, handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		if err := validate(ps); err != nil {
+			r.invalidParams(w, req, err)
+			return
+		}
+		handle(w, req, ps)
+	}
+}
+
+func (r *Router) decodeParams(decoders []paramDecoder, handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		ctx := req.Context()
+		for _, d := range decoders {
+			v, err := d.decode(ps.ByName(d.name))
+			if err != nil {
+				r.invalidParams(w, req, err)
+				return
+			}
+			ctx = context.WithValue(ctx, decodedParamKey(d.name), v)
+		}
+		handle(w, req.WithContext(ctx), ps)
+	}
+}
+
+// invalidParams answers a request with invalid params, see
+// Router.InvalidParams.
+func (r *Router) invalidParams(w http.ResponseWriter, req *http.Request, err error) {
+	if r.InvalidParams != nil {
+		r.InvalidParams(w, req, err)
+	} else {
+		r.Error(w, req, http.StatusBadRequest)
+	}
+}
+
+// choose calls alternate if the predicate is true for the request and handle
+// otherwise, see Route.When.
+func choose(predicate func(*http.Request) bool, alternate, handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		if predicate(req) {
+			alternate(w, req, ps)
+		} else {
+			handle(w, req, ps)
+		}
+	}
+}
+
+func (r *Router) checkContentType(consumes []string, handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil || !matchMediaType(consumes, mediaType) {
+			r.Error(w, req, http.StatusUnsupportedMediaType)
+			return
+		}
+		handle(w, req, ps)
+	}
+}
+
+// matchMediaType reports whether the media type matches one of the given
+// types, which may end with the wildcard "/*".
+func matchMediaType(types []string, mediaType string) bool {
+	for _, t := range types {
+		if t == mediaType || t == "*/*" ||
+			(strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteValidate(t *testing.T) {
+	var routed bool
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	}
+	validateID := func(ps Params) error {
+		id, err := strconv.Atoi(ps.ByName("id"))
+		if err != nil {
+			return err
+		}
+		if id < 1 || id > 100 {
+			return errors.New("id out of range")
+		}
+		return nil
+	}
+
+	router := New()
+	router.SaveMatchedRoutePath = true
+	router.GETR("/user/:id", handlerFunc).Validate(validateID)
+	// split the edge of the leaf of /user/:id
+	router.GET("/u", handlerFunc)
+
+	testRequests := []struct {
+		route  string
+		code   int
+		routed bool
+	}{
+		{"/user/42", http.StatusOK, true},
+		{"/user/0", http.StatusBadRequest, false},
+		{"/user/101", http.StatusBadRequest, false},
+		{"/user/gopher", http.StatusBadRequest, false},
+	}
+	for _, tr := range testRequests {
+		routed = false
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || routed != tr.routed {
+			t.Errorf("Validation of %s failed: Code=%d, routed=%v", tr.route, w.Code, routed)
+		}
+	}
+
+	// custom handler
+	var validationErr error
+	router.InvalidParams = func(w http.ResponseWriter, _ *http.Request, err error) {
+		validationErr = err
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	routed = false
+	r, _ := http.NewRequest(http.MethodGet, "/user/0", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusUnprocessableEntity || validationErr == nil || routed {
+		t.Errorf("Custom InvalidParams handler failed: Code=%d, err=%v, routed=%v", w.Code, validationErr, routed)
+	}
+}
+
+func TestRouteOnMethodNotAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.GETR("/x", handlerFunc).OnMethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("use GET or POST"))
+	}))
+	router.POST("/x", handlerFunc)
+	router.GET("/y", handlerFunc)
+
+	r, _ := http.NewRequest(http.MethodDelete, "/x", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "use GET or POST" {
+		t.Errorf("Path-specific 405 handler failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
+		t.Errorf("Unexpected Allow header: %q", allow)
+	}
+
+	// other paths use the global handler
+	r, _ = http.NewRequest(http.MethodDelete, "/y", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Global 405 handler was not used: Code=%d", w.Code)
+	}
+}
+
+func TestRouteMinCatchAllSegments(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GETR("/api/*rest", handlerFunc).MinCatchAllSegments(2)
+	router.GET("/files/*filepath", handlerFunc)
+
+	testRoutes := []struct {
+		route string
+		code  int
+	}{
+		{"/api/", http.StatusNotFound},
+		{"/api/users", http.StatusNotFound},
+		{"/api/users/", http.StatusNotFound},
+		{"/api//users", http.StatusNotFound},
+		{"/api/users/1", http.StatusOK},
+		{"/api/users/1/", http.StatusOK},
+		{"/files/", http.StatusOK}, // default 0
+	}
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code {
+			t.Errorf("Routing %s failed: want %d, got %d", tr.route, tr.code, w.Code)
+		}
+	}
+
+	// no redirect to a path not matching the route
+	router.Optimize()
+	r, _ := http.NewRequest(http.MethodGet, "/API/users", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Routing /API/users with index failed: want 404, got %d", w.Code)
+	}
+
+	recv := catchPanic(func() {
+		router.GETR("/user/:id", handlerFunc).MinCatchAllSegments(1)
+	})
+	if recv == nil {
+		t.Error("setting MinCatchAllSegments for a route without catch-all did not panic")
+	}
+}
+
+func TestRouterHandlerByName(t *testing.T) {
+	var name string
+	router := New()
+	router.GETR("/user/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		name = ps.ByName("name")
+	}).Name("user")
+	router.GET("/me", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		if handle, ok := router.HandlerByName("user"); ok {
+			handle(w, r, Params{{Key: "name", Value: "me"}})
+		}
+	})
+
+	handle, ok := router.HandlerByName("user")
+	if !ok {
+		t.Fatal("Named handle not found")
+	}
+	handle(httptest.NewRecorder(), nil, Params{{Key: "name", Value: "gopher"}})
+	if name != "gopher" {
+		t.Errorf("Wrong param value: %q", name)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/me", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if name != "me" {
+		t.Errorf("Dispatch to named handle failed: %q", name)
+	}
+
+	if _, ok := router.HandlerByName("nope"); ok {
+		t.Error("Unknown name was found")
+	}
+
+	recv := catchPanic(func() {
+		router.GETR("/other", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).Name("user")
+	})
+	if recv == nil {
+		t.Error("using a name twice did not panic")
+	}
+}
+
+func TestRouteDecode(t *testing.T) {
+	var decoded, seenByMiddleware interface{}
+	var decodeCalls int
+	decodeDate := func(s string) (interface{}, error) {
+		decodeCalls++
+		return time.Parse(time.RFC3339, s)
+	}
+
+	router := New()
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			seenByMiddleware = DecodedParam(r, "d")
+			next(w, r, ps)
+		}
+	})
+	router.GETR("/date/:d", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		decoded = DecodedParam(r, "d")
+	}).Decode("d", decodeDate)
+
+	r, _ := http.NewRequest(http.MethodGet, "/date/2024-02-29T12:00:00Z", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	want := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	if date, ok := decoded.(time.Time); w.Code != http.StatusOK || !ok || !date.Equal(want) {
+		t.Errorf("Wrong decoded value: Code=%d, value=%v", w.Code, decoded)
+	}
+	if seenByMiddleware != decoded || decodeCalls != 1 {
+		t.Errorf("Value not decoded once for the middleware: %v, %d calls", seenByMiddleware, decodeCalls)
+	}
+
+	decoded = nil
+	r, _ = http.NewRequest(http.MethodGet, "/date/yesterday", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || decoded != nil {
+		t.Errorf("Invalid value was not rejected: Code=%d, value=%v", w.Code, decoded)
+	}
+
+	var invalidErr error
+	router.InvalidParams = func(w http.ResponseWriter, _ *http.Request, err error) {
+		invalidErr = err
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusUnprocessableEntity || invalidErr == nil {
+		t.Errorf("InvalidParams was not called: Code=%d, err=%v", w.Code, invalidErr)
+	}
+
+	recv := catchPanic(func() {
+		router.GETR("/day/:d", func(_ http.ResponseWriter, _ *http.Request, _ Params) {}).Decode("date", decodeDate)
+	})
+	if recv == nil {
+		t.Error("Decoding an unknown param did not panic")
+	}
+}
+
+func TestRouteWhen(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name + ps.ByName("id")
+		}
+	}
+	isCanary := func(r *http.Request) bool {
+		return r.Header.Get("X-Canary") == "true"
+	}
+
+	var middlewareCalls int
+	router := New()
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			middlewareCalls++
+			next(w, r, ps)
+		}
+	})
+	router.GETR("/api/:id", handle("a")).When(isCanary, handle("b"))
+
+	tests := []struct {
+		canary string
+		routed string
+	}{
+		{"", "a1"},
+		{"false", "a1"},
+		{"true", "b1"},
+	}
+	for _, test := range tests {
+		routed = ""
+		r, _ := http.NewRequest(http.MethodGet, "/api/1", nil)
+		if test.canary != "" {
+			r.Header.Set("X-Canary", test.canary)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if routed != test.routed {
+			t.Errorf("Wrong handle for X-Canary=%q: want %q, got %q", test.canary, test.routed, routed)
+		}
+	}
+	if middlewareCalls != len(tests) {
+		t.Errorf("Middleware was not applied to both handles: %d calls", middlewareCalls)
+	}
+}
+
+func TestRouteConsumes(t *testing.T) {
+	var routed bool
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	}
+
+	router := New()
+	router.POSTR("/json", handlerFunc).Consumes("application/json")
+	router.POSTR("/any", handlerFunc).Consumes("text/plain", "application/*")
+
+	tests := []struct {
+		route       string
+		contentType string
+		code        int
+	}{
+		{"/json", "application/json", http.StatusOK},
+		{"/json", "Application/JSON; charset=utf-8", http.StatusOK},
+		{"/json", "text/plain", http.StatusUnsupportedMediaType},
+		{"/json", "", http.StatusUnsupportedMediaType},
+		{"/json", "application/json;;", http.StatusUnsupportedMediaType},
+		{"/any", "text/plain", http.StatusOK},
+		{"/any", "application/xml", http.StatusOK},
+		{"/any", "image/png", http.StatusUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		routed = false
+		r, _ := http.NewRequest(http.MethodPost, test.route, strings.NewReader("{}"))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != (test.code == http.StatusOK) {
+			t.Errorf("Wrong response for %s with Content-Type %q: want %d, got %d (routed=%v)",
+				test.route, test.contentType, test.code, w.Code, routed)
+		}
+	}
+}
+
+func TestRouteNoTSR(t *testing.T) {
+	router := New()
+	router.POSTR("/webhook", fakeHandler("")).NoTSR()
+	router.POSTR("/hooks/", fakeHandler("")).NoTSR()
+	router.POST("/other", fakeHandler(""))
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/webhook/", http.StatusNotFound, ""},
+		{"/WEBHOOK/", http.StatusNotFound, ""},
+		{"/WEBHOOK", http.StatusPermanentRedirect, "/webhook"},
+		{"/hooks", http.StatusNotFound, ""},
+		{"/other/", http.StatusPermanentRedirect, "/other"},
+		{"/webhook", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodPost, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("Wrong response for %s: want %d %q, got %d %q",
+				test.path, test.code, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
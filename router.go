@@ -43,6 +43,24 @@
 //  :name     named parameter
 //  *name     catch-all parameter
 //
+// The names of all parameters within one path must be distinct, e.g.
+// /:id/:name/:id is rejected.
+//
+// To match a literal ':' or '*', escape it with a backslash:
+//  Path: /repos/:owner/\*star
+//
+//  Requests:
+//   /repos/golang/*star                 match: owner="golang"
+//   /repos/golang/star                  no match
+//
+// A literal ':' can also be written as a doubled colon, e.g. for a segment
+// starting with a colon:
+//  Path: /ns/::system
+//
+//  Requests:
+//   /ns/:system                         match
+//   /ns/kube                            no match
+//
 // Named parameters are dynamic path segments. They match anything until the
 // next '/' or the path end:
 //  Path: /blog/:category/:post
@@ -78,9 +96,17 @@ package httprouter
 
 import (
 	"context"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 // Handle is a function that can be registered to a route to handle HTTP
@@ -88,6 +114,16 @@ import (
 // wildcards (path variables).
 type Handle func(http.ResponseWriter, *http.Request, Params)
 
+// ToHTTPHandler returns an http.HandlerFunc which calls the handle with the
+// URL parameters stored in the request context, e.g. by Router.Handler. The
+// parameters are looked up under ParamsKey or the given key, like with
+// ParamsFromContext. If no parameters are present, the handle gets nil Params.
+func (h Handle) ToHTTPHandler(key ...interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		h(w, req, ParamsFromContext(req.Context(), key...))
+	}
+}
+
 // Param is a single URL parameter, consisting of a key and a value.
 type Param struct {
 	Key   string
@@ -97,6 +133,10 @@ type Param struct {
 // Params is a Param-slice, as returned by the router.
 // The slice is ordered, the first URL parameter is also the first slice value.
 // It is therefore safe to read values by the index.
+// The length of the slice is the exact number of params of the matched route,
+// e.g. to preallocate a map with make(map[string]string, len(ps)), while its
+// capacity is the maximum number of params of all routes and should not be
+// relied on.
 type Params []Param
 
 // ByName returns the value of the first Param which key matches the given name.
@@ -110,6 +150,72 @@ func (ps Params) ByName(name string) string {
 	return ""
 }
 
+// Has reports whether a Param with the given name exists, which allows to
+// distinguish an empty value from a missing Param.
+func (ps Params) Has(name string) bool {
+	for _, p := range ps {
+		if p.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the value of the first Param which key matches the given name
+// and reports whether such a Param was found.
+func (ps Params) Lookup(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByNameDefault is like ByName, but returns def if no matching Param is found
+// or its value is empty.
+func (ps Params) ByNameDefault(name, def string) string {
+	if v, ok := ps.Lookup(name); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// GetAll returns the values of all Params which key matches the given name, in
+// the order of the Params. If no matching Param is found, nil is returned.
+func (ps Params) GetAll(name string) []string {
+	var values []string
+	for _, p := range ps {
+		if p.Key == name {
+			values = append(values, p.Value)
+		}
+	}
+	return values
+}
+
+// Encode encodes the Params as URL query string, e.g. "id=42&name=go+pher",
+// sorted by key like url.Values.Encode. Empty Params are encoded as "".
+func (ps Params) Encode() string {
+	if len(ps) == 0 {
+		return ""
+	}
+	values := make(url.Values, len(ps))
+	for _, p := range ps {
+		values.Add(p.Key, p.Value)
+	}
+	return values.Encode()
+}
+
+// ForEach calls fn for each Param in order with its key and value, until fn
+// returns false.
+func (ps Params) ForEach(fn func(key, value string) bool) {
+	for _, p := range ps {
+		if !fn(p.Key, p.Value) {
+			return
+		}
+	}
+}
+
 type paramsKey struct{}
 
 // ParamsKey is the request context key under which URL params are stored.
@@ -117,11 +223,50 @@ var ParamsKey = paramsKey{}
 
 // ParamsFromContext pulls the URL parameters from a request context,
 // or returns nil if none are present.
-func ParamsFromContext(ctx context.Context) Params {
-	p, _ := ctx.Value(ParamsKey).(Params)
+// The parameters are looked up under ParamsKey, unless another key is given,
+// e.g. the ContextKey of a Router.
+func ParamsFromContext(ctx context.Context, key ...interface{}) Params {
+	var k interface{} = ParamsKey
+	if len(key) > 0 {
+		k = key[0]
+	}
+	p, _ := ctx.Value(k).(Params)
 	return p
 }
 
+// WithParams returns a copy of ctx in which the given URL parameters are
+// stored under ParamsKey.
+func WithParams(ctx context.Context, ps Params) context.Context {
+	return context.WithValue(ctx, ParamsKey, ps)
+}
+
+// paramsKey returns the key under which the router stores the URL params in
+// the request context.
+func (r *Router) paramsKey() interface{} {
+	if r.ContextKey != nil {
+		return r.ContextKey
+	}
+	return ParamsKey
+}
+
+// withParams is like WithParams, but stores the params under the ContextKey
+// of the router.
+func (r *Router) withParams(ctx context.Context, ps Params) context.Context {
+	return context.WithValue(ctx, r.paramsKey(), ps)
+}
+
+// NewRequestWithParams returns a new request like http.NewRequest with the
+// given URL parameters stored in its context, as ParamsFromContext expects
+// them. It is intended for testing handlers without a Router and panics if
+// the request can not be created, e.g. because of an invalid method or target.
+func NewRequestWithParams(method, target string, body io.Reader, ps Params) *http.Request {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		panic("invalid request: " + err.Error())
+	}
+	return req.WithContext(WithParams(req.Context(), ps))
+}
+
 // MatchedRoutePathParam is the Param name under which the path of the matched
 // route is stored, if Router.SaveMatchedRoutePath is set.
 var MatchedRoutePathParam = "$matchedRoutePath"
@@ -133,13 +278,97 @@ func (ps Params) MatchedRoutePath() string {
 	return ps.ByName(MatchedRoutePathParam)
 }
 
+// CatchAll returns the name and the value of the catch-all parameter of the
+// matched route, e.g. "filepath" and "/css/site.css" for the route
+// /static/*filepath, so that generic handles need not know its name.
+// ok is false, if the route has no catch-all parameter.
+// The parameter is determined from the path of the matched route, so
+// Router.SaveMatchedRoutePath must have been enabled when the respective
+// handler was added, otherwise ok is always false.
+func (ps Params) CatchAll() (name, value string, ok bool) {
+	n := len(ps)
+	if n < 2 || ps[n-1].Key != MatchedRoutePathParam {
+		return "", "", false
+	}
+	route := ps[n-1].Value
+	// The catch-all parameter is the last segment of the route path, unlike
+	// an escaped '*'
+	i := strings.LastIndexByte(route, '*')
+	if i < 1 || route[i-1] != '/' || route[i+1:] != ps[n-2].Key {
+		return "", "", false
+	}
+	return ps[n-2].Key, ps[n-2].Value, true
+}
+
+// CatchAllPrefix returns the part of the request path before the catch-all
+// parameter of the matched route, e.g. "/proxy" for the route /proxy/*rest.
+// Named parameters in the prefix are replaced by their values.
+// Together with the value of the catch-all parameter this allows to rewrite
+// the request URL without string manipulation of the request path.
+// The path parameters are read from the request context, see Handler, under
+// ParamsKey or the given key, like with ParamsFromContext.
+// Router.SaveMatchedRoutePath must have been enabled when the respective
+// handler was added and the route must end with a catch-all parameter,
+// otherwise this function always returns an empty string.
+func CatchAllPrefix(r *http.Request, key ...interface{}) string {
+	ps := ParamsFromContext(r.Context(), key...)
+
+	route := ps.MatchedRoutePath()
+	end := strings.Index(route, "/*")
+	if end < 0 {
+		return ""
+	}
+
+	var prefix string
+	path := route[:end]
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			break
+		}
+		prefix += unescapePath(path[:i]) + ps.ByName(wildcard[1:])
+		path = path[i+len(wildcard):]
+	}
+	return prefix + unescapePath(path)
+}
+
 // Router is a http.Handler which can be used to dispatch requests to different
 // handler functions via configurable routes
 type Router struct {
 	trees map[string]*node
 
+	// Trees of the routes registered for a host, keyed by host and method
+	hostTrees map[string]map[string]*node
+
+	// Server-wide CONNECT handle, registered with the path "*"
+	connect *node
+
+	// All registered routes in the order of their registration
+	routes []*Route
+
+	// Named routes, see Route.Name
+	names map[string]*Route
+
+	// Indexes of the lowercased routes per method, built by Optimize
+	caseIndexes map[string]*caseIndex
+
 	paramsPool sync.Pool
 	maxParams  uint16
+	storePool  sync.Pool
+
+	lookupTimings lookupTimings
+
+	// Prefix removed from the request path, see StripPrefix
+	stripPrefix string
+
+	// Handle called for requests without a matching route, see Any
+	fallback Handle
+
+	middleware []func(Handle) Handle
+	decorators []routeDecorator
+
+	// Handlers of the error pages per status code, see ErrorPage
+	errorPages map[int]http.Handler
 
 	// If enabled, adds the matched route path onto the http.Request context
 	// before invoking the handler.
@@ -147,6 +376,44 @@ type Router struct {
 	// registered when this option was enabled.
 	SaveMatchedRoutePath bool
 
+	// If enabled, each request dispatched to a route carries a request-scoped
+	// Store in its context, which middleware can use to pass values down to
+	// the handle, see Values, WithValue and Value. The stores are reused, a
+	// store is cleared once the handle returned, unless the handle still runs
+	// after its timeout expired, see DefaultTimeout.
+	ValueStore bool
+
+	// If set, the handles of all routes registered afterwards are given at
+	// most this duration to write the response header, unless the route sets
+	// another timeout, see Route.Timeout. The request context of the handle
+	// carries the deadline, so that it can be passed on to clients of
+	// databases or other services, and is canceled when the timeout expires.
+	// If the handle did not write the response header by then, the request is
+	// answered with 503 (Service Unavailable) and further writes of the handle
+	// fail with http.ErrHandlerTimeout. Otherwise the response is completed by
+	// the handle, which should stop when the context is done.
+	DefaultTimeout time.Duration
+
+	// If set, the Retry-After header is set to this duration, rounded up to
+	// full seconds, on the 503 (Service Unavailable) response sent when a
+	// route times out, see DefaultTimeout and Route.Timeout, as a backoff
+	// hint for clients and load balancers.
+	RetryAfter time.Duration
+
+	// If set, the body of each request is limited to this number of bytes
+	// with an http.MaxBytesReader before the request is dispatched. Reading
+	// past the limit fails with an *http.MaxBytesError, which handles should
+	// answer with 413 (Request Entity Too Large), e.g. with Error.
+	MaxBodyBytes int64
+
+	// If enabled, file servers registered with ServeFiles serve the
+	// index.html of a directory requested without a trailing slash directly,
+	// e.g. /docs/guide/index.html for /docs/guide, instead of redirecting to
+	// the path with a trailing slash, e.g. for single-page applications served
+	// per directory. Note that relative links in the served page are then
+	// resolved relative to the parent directory.
+	FileDirIndexNoRedirect bool
+
 	// Enables automatic redirection if the current route can't be matched but a
 	// handler for the path with (without) the trailing slash exists.
 	// For example if /foo/ is requested but a route only exists for /foo, the
@@ -165,44 +432,238 @@ type Router struct {
 	// RedirectTrailingSlash is independent of this option.
 	RedirectFixedPath bool
 
+	// If enabled, only requests with paths matching a route exactly are
+	// routed. The router then never redirects requests to a route with
+	// another path, regardless of RedirectTrailingSlash, RedirectFixedPath and
+	// CatchAllTrailingSlashRedirect, and answers them with 404 instead, e.g.
+	// for an internal admin router, which must not reveal its routes by
+	// redirects.
+	ExactMatchOnly bool
+
+	// If enabled, requests to another host than CanonicalHost are redirected
+	// to the same path and query on CanonicalHost before they are routed, e.g.
+	// from example.com to www.example.com, with status code 301 for GET
+	// requests and 308 for all other request methods. The port of the request
+	// is ignored when comparing the hosts.
+	RedirectToCanonicalHost bool
+
+	// The host requests are redirected to, if RedirectToCanonicalHost is
+	// enabled, e.g. www.example.com, optionally with a port. If it is empty,
+	// no request is redirected.
+	CanonicalHost string
+
+	// Paths of routes, e.g. health checks, which are never redirected to
+	// CanonicalHost. They are compared to the path the router matches, i.e.
+	// after PathExtractor and without the prefix set with StripPrefix.
+	CanonicalHostExempt []string
+
+	// By default, the router matches against the decoded request path, which
+	// means that an encoded slash (%2F) is treated like a literal '/' and
+	// splits path segments. /files/a%2Fb is then routed as /files/a/b.
+	// If enabled, the router matches against the escaped request path
+	// instead. %2F is then kept as part of a single parameter value, e.g.
+	// /files/:name matches /files/a%2Fb with name="a%2Fb". Note that all
+	// parameter values and static path segments are then in their escaped
+	// form.
+	// Handlers should be careful when using parameter values containing
+	// slashes to build file system paths, as a decoded value like "../x" may
+	// otherwise be used for path traversal.
+	KeepEncodedSlash bool
+
+	// An optional function which returns the path the router matches a
+	// request against, e.g. the value of a header like X-Forwarded-Path set
+	// by a proxy. If it is not set, the path of the request URL is used.
+	// The returned path must be of the form selected by KeepEncodedSlash,
+	// i.e. escaped if KeepEncodedSlash is enabled. It is also the base of
+	// the redirects made because of RedirectTrailingSlash and
+	// RedirectFixedPath.
+	PathExtractor func(*http.Request) string
+
+	// The key under which the router stores the URL params in the request
+	// context, e.g. for handles registered with Handler. If it is not set,
+	// ParamsKey is used. A distinct key keeps the params of several routers
+	// apart, e.g. of different copies of this package in one binary.
+	// The params can then be read with ParamsFromContext(ctx, key).
+	ContextKey interface{}
+
+	// If enabled, the values of path parameters are unescaped with
+	// url.PathUnescape before the handle is invoked, e.g. hello%20world
+	// becomes "hello world". Requests with invalid escapes in a parameter
+	// value are answered with 400 Bad Request.
+	// This option only has an effect if KeepEncodedSlash is enabled, as
+	// otherwise the router matches against the already decoded path.
+	UnescapePathParams bool
+
+	// If enabled, the value of catch-all parameters is cleaned with CleanPath
+	// before the handle is invoked. Thereby . and .. elements are eliminated,
+	// e.g. /files/*filepath matches /files/../../etc/passwd with
+	// filepath="/etc/passwd", so the value can not escape the root the
+	// handler serves from.
+	// This is meant as defense in depth, handlers should still validate the
+	// values they use to access resources.
+	CleanCatchAll bool
+
+	// If enabled, the leading '/' is trimmed from the value of catch-all
+	// parameters, e.g. /static/*filepath matches /static/css/app.css with
+	// filepath="css/app.css" instead of "/css/app.css", which is convenient
+	// for joining the value with a root directory.
+	TrimCatchAllLeadingSlash bool
+
+	// If enabled, the bare prefix of a catch-all route is redirected to the
+	// prefix with a trailing slash, e.g. /files to /files/ for the route
+	// /files/*filepath, so the catch-all matches with filepath="/". This
+	// already happens if RedirectTrailingSlash is enabled, this option
+	// enables it for catch-all routes only.
+	CatchAllTrailingSlashRedirect bool
+
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
 	// If this is the case, the request is answered with 'Method Not Allowed'
 	// and HTTP status code 405.
 	// If no other Method is allowed, the request is delegated to the NotFound
 	// handler.
+	// HEAD requests are not answered by GET handles automatically, i.e. a HEAD
+	// request for a path with only a GET route is answered with 405 and an
+	// "Allow" header listing GET, unless a HEAD route is registered as well.
 	HandleMethodNotAllowed bool
 
+	// If enabled, the method of requests is uppercased before they are
+	// dispatched, so that e.g. a request with the method "get" is handled by
+	// the GET routes. HTTP methods are case-sensitive, so this deviates from
+	// the specification, but helps with misbehaving clients.
+	NormalizeMethod bool
+
+	// If enabled, the router automatically replies to TRACE requests, for
+	// which no route matches, by echoing the received request line, headers
+	// and body with the Content-Type message/http.
+	// Since the echo reveals headers like Cookie or Authorization to scripts
+	// which can send TRACE requests (cross-site tracing), and security
+	// scanners commonly flag it, the secure default is to keep it disabled.
+	EnableTRACE bool
+
+	// If enabled, HEAD requests, for which no HEAD route matches, are handled
+	// by the matching GET route, whose response body is discarded. Unlike
+	// registering a HEAD route for each GET route, this costs a second lookup
+	// only for HEAD requests.
+	HeadFallsBackToGet bool
+
+	// If enabled, the duration of the lookup of each request in the tree,
+	// excluding the handle, is recorded, see LookupTimings. This isolates the
+	// cost of the routing from the cost of the handles, e.g. to detect
+	// performance regressions.
+	EnableLookupTiming bool
+
+	// Function called for each request, which does not directly match a
+	// route, e.g. to log why a request was redirected or answered with 404.
+	// tsr reports whether a route exists with an added or removed trailing
+	// slash, fixedPath is the path found by RedirectFixedPath, if any, and
+	// matched reports whether the request is redirected to either of them.
+	OnNoMatch func(method, path string, tsr bool, fixedPath string, matched bool)
+
+	// Function called after each route was registered with its method and its
+	// full path, e.g. including the prefix of a RouteGroup, to build a catalog
+	// of the routes while modules register them. Routes registered for a
+	// host with HostHandle are reported without the host.
+	OnRegister func(method, path string)
+
 	// If enabled, the router automatically replies to OPTIONS requests.
 	// Custom OPTIONS handlers take priority over automatic replies.
 	HandleOPTIONS bool
 
-	// An optional http.Handler that is called on automatic OPTIONS requests.
+	// If enabled, OPTIONS is listed in the "Allow" header of 405 responses,
+	// if a custom OPTIONS handle is registered for the path, also if
+	// HandleOPTIONS is disabled. If HandleOPTIONS is enabled, OPTIONS is always
+	// listed, since the router replies to OPTIONS requests itself.
+	// For the server-wide OPTIONS * request, the option must be set before the
+	// routes are registered.
+	IncludeOptionsInAllow bool
+
+	// An optional http.Handler that is called on automatic OPTIONS requests,
+	// including the server-wide OPTIONS * request, instead of the automatic
+	// reply configured by OptionsStatusCode and OptionsBody.
 	// The handler is only called if HandleOPTIONS is true and no OPTIONS
 	// handler for the specific path was set.
 	// The "Allowed" header is set before calling the handler.
 	GlobalOPTIONS http.Handler
 
+	// The status code and the body of automatic replies to OPTIONS requests,
+	// if no GlobalOPTIONS handler is set. If OptionsStatusCode is 0, the
+	// status code is 200 (OK), e.g. http.StatusNoContent can be used instead.
+	// The body is empty by default and should be left empty for 204.
+	OptionsStatusCode int
+	OptionsBody       []byte
+
+	// An optional CORS configuration for automatic replies to CORS preflight
+	// requests. The configuration of a specific route, see Route.CORS, takes
+	// priority. The headers are set before the GlobalOPTIONS handler is
+	// called.
+	CORS *CORS
+
+	// If set, automatic replies to CORS preflight requests carry the
+	// Access-Control-Max-Age header with this duration in seconds, so that
+	// browsers cache the result of the preflight. Other OPTIONS requests are
+	// not affected. The header is set before the GlobalOPTIONS handler is
+	// called.
+	PreflightMaxAge time.Duration
+
+	// Optional headers which are set on every response before the request is
+	// dispatched, including automatic replies like 404 Not Found and
+	// 405 Method Not Allowed, e.g. security headers like
+	// X-Content-Type-Options. Handles can still overwrite or delete them.
+	DefaultHeaders http.Header
+
 	// Cached value of global (*) allowed methods
 	globalAllowed string
 
+	// If enabled, 404 responses carry the header X-Suggested-Route with the
+	// path of the registered route closest to the request path by edit
+	// distance, e.g. /users for a request to /usres, if one is close enough.
+	// It is meant for development, since it compares the request path with
+	// all routes and reveals them to clients.
+	SuggestRoutes bool
+
 	// Configurable http.Handler which is called when no matching route is
-	// found. If it is not set, http.NotFound is used.
+	// found. If it is not set, the error page for 404 is used, see ErrorPage.
 	NotFound http.Handler
 
+	// If enabled, the NotFound handler is treated as the next link in a chain
+	// of handlers, e.g. another Router: if it does not write a response, the
+	// request is answered with the error page for 404, as if no NotFound
+	// handler was set. For a chained Router this can be achieved by setting
+	// its NotFound handler to a handler which does nothing.
+	NotFoundChain bool
+
 	// Configurable http.Handler which is called when a request
 	// cannot be routed and HandleMethodNotAllowed is true.
-	// If it is not set, http.Error with http.StatusMethodNotAllowed is used.
+	// If it is not set, the error page for 405 is used, see ErrorPage.
 	// The "Allow" header with allowed request methods is set before the handler
-	// is called.
+	// is called. A handler set for a specific path with
+	// Route.OnMethodNotAllowed takes priority.
 	MethodNotAllowed http.Handler
 
 	// Function to handle panics recovered from http handlers.
 	// It should be used to generate a error page and return the http error code
-	// 500 (Internal Server Error).
+	// 500 (Internal Server Error), e.g. with Router.Error, which uses the
+	// error page registered for 500, see ErrorPage.
 	// The handler can be used to keep your server from crashing because of
 	// unrecovered panics.
+	// If the handle panicked after the response header was written, the status
+	// can not be changed anymore, which HeaderWritten reports.
 	PanicHandler func(http.ResponseWriter, *http.Request, interface{})
+
+	// Function to handle requests with params rejected by the validator or a
+	// decoder of the matched route, see Route.Validate and Route.Decode. The
+	// error returned by the validator or decoder is passed to the function.
+	// If it is not set, the request is answered with the error page for 400
+	// (Bad Request), see ErrorPage.
+	InvalidParams func(http.ResponseWriter, *http.Request, error)
+
+	// An optional structured logger. If set, the router logs a line for each
+	// request with the method, the matched route path, the response status,
+	// the duration and the remote address. Requests which could not be routed
+	// are logged with an empty route path.
+	// Panics are logged with level error before the PanicHandler is called.
+	Logger *slog.Logger
 }
 
 // Make sure the Router conforms with the http.Handler interface
@@ -231,6 +692,152 @@ func (r *Router) putParams(ps *Params) {
 	}
 }
 
+// isCatchAllPrefix reports whether path with an added trailing slash is
+// matched by a catch-all route.
+func isCatchAllPrefix(root *node, path string) bool {
+	if len(path) > 0 && path[len(path)-1] == '/' {
+		return false
+	}
+	leaf, _, _ := root.getValue(path+"/", nil)
+	return leaf != nil && leaf.nType == catchAll
+}
+
+// trace answers a TRACE request with the received request, see EnableTRACE.
+func (r *Router) trace(w http.ResponseWriter, req *http.Request) {
+	dump, err := httputil.DumpRequest(req, true)
+	if err != nil {
+		r.Error(w, req, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "message/http")
+	w.Write(dump)
+}
+
+// setRetryAfter sets the Retry-After header, if RetryAfter is set.
+func (r *Router) setRetryAfter(w http.ResponseWriter) {
+	if r.RetryAfter > 0 {
+		seconds := (r.RetryAfter + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(seconds), 10))
+	}
+}
+
+// redirectToCanonicalHost redirects the request to CanonicalHost and reports
+// true, if the request is not sent to it, see RedirectToCanonicalHost. path is
+// the path the router matches, which is compared to CanonicalHostExempt.
+func (r *Router) redirectToCanonicalHost(w http.ResponseWriter, req *http.Request, path string) bool {
+	canonical := r.CanonicalHost
+	if canonical == "" || strings.EqualFold(req.Host, canonical) ||
+		strings.EqualFold(requestHost(req), canonical) {
+		return false
+	}
+	for _, exempt := range r.CanonicalHostExempt {
+		if path == exempt {
+			return false
+		}
+	}
+
+	u := *req.URL
+	u.Scheme = "http"
+	if req.TLS != nil {
+		u.Scheme = "https"
+	}
+	u.Host = canonical
+
+	code := http.StatusMovedPermanently
+	if req.Method != http.MethodGet {
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, req, u.String(), code)
+	return true
+}
+
+// requestHost returns the host of the request without the port, lowercased.
+// Unlike net.SplitHostPort and strings.ToLower, it does not allocate for the
+// common host names.
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') &&
+		(host[0] == '[' || strings.IndexByte(host, ':') == i) {
+		host = host[:i]
+	}
+	if len(host) > 1 && host[0] == '[' && host[len(host)-1] == ']' {
+		host = host[1 : len(host)-1]
+	}
+	for i := 0; i < len(host); i++ {
+		if c := host[i]; 'A' <= c && c <= 'Z' || c >= utf8.RuneSelf {
+			return strings.ToLower(host)
+		}
+	}
+	return host
+}
+
+// StripPrefix sets a prefix, which is removed from the request path before
+// the router matches it, e.g. /myapp for an application deployed below /myapp/
+// behind a proxy, which does not remove it. The routes are then registered
+// without the prefix, e.g. /users for requests to /myapp/users. Requests to
+// paths without the prefix are answered with 404, see NotFound. The redirects
+// of the router keep the prefix.
+// The prefix is also removed from paths returned by PathExtractor.
+func (r *Router) StripPrefix(prefix string) {
+	if prefix != "" && prefix[0] != '/' {
+		panic("prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	r.stripPrefix = strings.TrimSuffix(prefix, "/")
+}
+
+// getPath returns the request path the router matches against, without the
+// prefix set with StripPrefix. ok is false, if the path lacks the prefix.
+func (r *Router) getPath(req *http.Request) (path string, ok bool) {
+	switch {
+	case r.PathExtractor != nil:
+		path = r.PathExtractor(req)
+	case r.KeepEncodedSlash:
+		path = req.URL.EscapedPath()
+	default:
+		path = req.URL.Path
+	}
+	if r.stripPrefix == "" {
+		return path, true
+	}
+
+	rest := strings.TrimPrefix(path, r.stripPrefix)
+	if len(rest) == len(path) || (rest != "" && rest[0] != '/') {
+		return "", false
+	}
+	if rest == "" {
+		rest = "/"
+	}
+	return rest, true
+}
+
+// setPath replaces the path of the request URL with the given path, which
+// must be of the same form as returned by getPath. The prefix set with
+// StripPrefix is prepended.
+func (r *Router) setPath(req *http.Request, path string) {
+	path = r.stripPrefix + path
+	if r.KeepEncodedSlash {
+		if p, err := url.PathUnescape(path); err == nil {
+			req.URL.Path = p
+			req.URL.RawPath = path
+			return
+		}
+	}
+	req.URL.Path = path
+}
+
+// unescapeParams unescapes the values of the given params in place.
+// It returns false if any of the values contains an invalid escape.
+func unescapeParams(ps Params) bool {
+	for i := range ps {
+		v, err := url.PathUnescape(ps[i].Value)
+		if err != nil {
+			return false
+		}
+		ps[i].Value = v
+	}
+	return true
+}
+
 func (r *Router) saveMatchedRoutePath(path string, handle Handle) Handle {
 	return func(w http.ResponseWriter, req *http.Request, ps Params) {
 		if ps == nil {
@@ -248,37 +855,72 @@ func (r *Router) saveMatchedRoutePath(path string, handle Handle) Handle {
 
 // GET is a shortcut for router.Handle(http.MethodGet, path, handle)
 func (r *Router) GET(path string, handle Handle) {
-	r.Handle(http.MethodGet, path, handle)
+	r.HandleR(http.MethodGet, path, handle)
+}
+
+// GETR is a shortcut for router.HandleR(http.MethodGet, path, handle)
+func (r *Router) GETR(path string, handle Handle) *Route {
+	return r.HandleR(http.MethodGet, path, handle)
 }
 
 // HEAD is a shortcut for router.Handle(http.MethodHead, path, handle)
 func (r *Router) HEAD(path string, handle Handle) {
-	r.Handle(http.MethodHead, path, handle)
+	r.HandleR(http.MethodHead, path, handle)
+}
+
+// HEADR is a shortcut for router.HandleR(http.MethodHead, path, handle)
+func (r *Router) HEADR(path string, handle Handle) *Route {
+	return r.HandleR(http.MethodHead, path, handle)
 }
 
 // OPTIONS is a shortcut for router.Handle(http.MethodOptions, path, handle)
 func (r *Router) OPTIONS(path string, handle Handle) {
-	r.Handle(http.MethodOptions, path, handle)
+	r.HandleR(http.MethodOptions, path, handle)
+}
+
+// OPTIONSR is a shortcut for router.HandleR(http.MethodOptions, path, handle)
+func (r *Router) OPTIONSR(path string, handle Handle) *Route {
+	return r.HandleR(http.MethodOptions, path, handle)
 }
 
 // POST is a shortcut for router.Handle(http.MethodPost, path, handle)
 func (r *Router) POST(path string, handle Handle) {
-	r.Handle(http.MethodPost, path, handle)
+	r.HandleR(http.MethodPost, path, handle)
+}
+
+// POSTR is a shortcut for router.HandleR(http.MethodPost, path, handle)
+func (r *Router) POSTR(path string, handle Handle) *Route {
+	return r.HandleR(http.MethodPost, path, handle)
 }
 
 // PUT is a shortcut for router.Handle(http.MethodPut, path, handle)
 func (r *Router) PUT(path string, handle Handle) {
-	r.Handle(http.MethodPut, path, handle)
+	r.HandleR(http.MethodPut, path, handle)
+}
+
+// PUTR is a shortcut for router.HandleR(http.MethodPut, path, handle)
+func (r *Router) PUTR(path string, handle Handle) *Route {
+	return r.HandleR(http.MethodPut, path, handle)
 }
 
 // PATCH is a shortcut for router.Handle(http.MethodPatch, path, handle)
 func (r *Router) PATCH(path string, handle Handle) {
-	r.Handle(http.MethodPatch, path, handle)
+	r.HandleR(http.MethodPatch, path, handle)
+}
+
+// PATCHR is a shortcut for router.HandleR(http.MethodPatch, path, handle)
+func (r *Router) PATCHR(path string, handle Handle) *Route {
+	return r.HandleR(http.MethodPatch, path, handle)
 }
 
 // DELETE is a shortcut for router.Handle(http.MethodDelete, path, handle)
 func (r *Router) DELETE(path string, handle Handle) {
-	r.Handle(http.MethodDelete, path, handle)
+	r.HandleR(http.MethodDelete, path, handle)
+}
+
+// DELETER is a shortcut for router.HandleR(http.MethodDelete, path, handle)
+func (r *Router) DELETER(path string, handle Handle) *Route {
+	return r.HandleR(http.MethodDelete, path, handle)
 }
 
 // Handle registers a new request handle with the given path and method.
@@ -289,13 +931,63 @@ func (r *Router) DELETE(path string, handle Handle) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
+//
+// A proxy can register a server-wide handle for all CONNECT requests with
+// router.Handle(http.MethodConnect, "*", handle). It is called for every
+// CONNECT request for which no other CONNECT route matches. CONNECT requests
+// are never redirected. To establish a tunnel, the handle typically takes
+// over the connection with http.NewResponseController(w).Hijack(), which is
+// supported by the ResponseWriter passed to the handle, also if the router
+// wraps it.
 func (r *Router) Handle(method, path string, handle Handle) {
+	r.handle("", method, path, handle)
+}
+
+// HandleR is like Handle, but returns the registered Route, which can be used
+// to configure further options of the route:
+//  router.HandleR(http.MethodGet, "/user/:id", handle).Name("user")
+// The same applies to the shortcuts GETR, POSTR etc. and to HandlerR and
+// HandlerFuncR.
+func (r *Router) HandleR(method, path string, handle Handle) *Route {
+	return r.handle("", method, path, handle)
+}
+
+// HostGET is a shortcut for router.HostHandle(http.MethodGet, host, path, handle)
+func (r *Router) HostGET(host, path string, handle Handle) *Route {
+	return r.HostHandle(http.MethodGet, host, path, handle)
+}
+
+// HostHandle registers a new request handle with the given path and method,
+// which only matches requests to the given host, e.g. to serve a.com/x and
+// b.com/x with different handles. The host is compared case-insensitively
+// and without the port of the request.
+// Requests to a host are matched against the routes registered for it first
+// and fall back to the routes registered with Handle, which also handle the
+// redirects and the 404 and 405 responses, if none matches.
+// Host routes are not considered by Lookup, LookupInfo, MethodsFor,
+// SetEnabled and Optimize. Walk and OnRegister report them with their path
+// only, Routes returns them with their host, see Route.Host.
+func (r *Router) HostHandle(method, host, path string, handle Handle) *Route {
+	if host == "" {
+		panic("host must not be empty")
+	}
+	if path == "*" {
+		panic("path '*' is not allowed for a host")
+	}
+	return r.handle(strings.ToLower(host), method, path, handle)
+}
+
+func (r *Router) handle(host, method, path string, handle Handle) *Route {
 	varsCount := uint16(0)
 
 	if method == "" {
 		panic("method must not be empty")
 	}
-	if len(path) < 1 || path[0] != '/' {
+	if path == "*" {
+		if method != http.MethodConnect {
+			panic("path '*' is only allowed for method CONNECT")
+		}
+	} else if len(path) < 1 || path[0] != '/' {
 		panic("path must begin with '/' in path '" + path + "'")
 	}
 	if handle == nil {
@@ -304,26 +996,72 @@ func (r *Router) Handle(method, path string, handle Handle) {
 
 	if r.SaveMatchedRoutePath {
 		varsCount++
-		handle = r.saveMatchedRoutePath(path, handle)
 	}
 
-	if r.trees == nil {
-		r.trees = make(map[string]*node)
+	route := &Route{
+		router:               r,
+		method:               method,
+		path:                 path,
+		host:                 host,
+		handle:               handle,
+		middleware:           r.middleware[:len(r.middleware):len(r.middleware)],
+		saveMatchedRoutePath: r.SaveMatchedRoutePath,
+		timeout:              r.DefaultTimeout,
 	}
+	handle = route.compose()
 
-	root := r.trees[method]
-	if root == nil {
-		root = new(node)
-		r.trees[method] = root
+	if path == "*" {
+		// Server-wide CONNECT handle, which is not part of any tree
+		if r.connect != nil {
+			panic("a handle is already registered for path '*'")
+		}
+		route.leaf = &node{path: path, handle: handle, fullPath: path}
+		route.leaf.route = route
+		r.connect = route.leaf
+	} else if host != "" {
+		if r.hostTrees == nil {
+			r.hostTrees = make(map[string]map[string]*node)
+		}
+		trees := r.hostTrees[host]
+		if trees == nil {
+			trees = make(map[string]*node)
+			r.hostTrees[host] = trees
+		}
 
-		r.globalAllowed = r.allowed("*", "")
-	}
+		root := trees[method]
+		if root == nil {
+			root = new(node)
+			trees[method] = root
+		}
 
-	root.addRoute(path, handle)
+		route.leaf = root.addRoute(path, handle)
+		route.leaf.route = route
+	} else {
+		if r.trees == nil {
+			r.trees = make(map[string]*node)
+		}
+
+		root := r.trees[method]
+		if root == nil {
+			root = new(node)
+			r.trees[method] = root
+
+			r.globalAllowed = r.allowed("*", "")
+		}
+
+		route.leaf = root.addRoute(path, handle)
+		route.leaf.route = route
+	}
+	r.routes = append(r.routes, route)
+	delete(r.caseIndexes, method)
 
 	// Update maxParams
-	if paramsCount := countParams(path); paramsCount+varsCount > r.maxParams {
-		r.maxParams = paramsCount + varsCount
+	paramsCount := varsCount
+	if path != "*" {
+		paramsCount += countParams(path)
+	}
+	if paramsCount > r.maxParams {
+		r.maxParams = paramsCount
 	}
 
 	// Lazy-init paramsPool alloc func
@@ -333,18 +1071,80 @@ func (r *Router) Handle(method, path string, handle Handle) {
 			return &ps
 		}
 	}
+
+	if r.OnRegister != nil {
+		r.OnRegister(method, path)
+	}
+	return route
+}
+
+// Use appends the given middleware to the middleware stack of the router.
+// The middleware is applied to all handles registered after the call to Use,
+// handles registered before are not affected.
+// The middleware passed first is the outermost one, i.e. it is called first
+// when a request is handled.
+// A middleware short-circuits a request by not calling the next handle, e.g.
+// to reject unauthenticated requests:
+//  router.Use(func(next httprouter.Handle) httprouter.Handle {
+//      return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+//          if !authenticated(r) {
+//              httprouter.Abort(w, http.StatusUnauthorized)
+//              return
+//          }
+//          next(w, r, ps)
+//      }
+//  })
+// The response is then logged with its status like any other, see Logger.
+func (r *Router) Use(middleware ...func(Handle) Handle) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+type routeDecorator struct {
+	match    func(method, path string) bool
+	decorate func(Handle) Handle
+}
+
+// Decorate wraps the handles of all routes for which match returns true with
+// the given decorator, e.g. to apply a middleware only to the routes below
+// /admin/. match is called with the method and the path of each route, as it
+// was registered. Unlike Use, Decorate also applies to the routes registered
+// before the call.
+// Decorators are applied within the middleware added with Use, the decorator
+// passed first is the outermost one.
+func (r *Router) Decorate(match func(method, path string) bool, decorator func(Handle) Handle) {
+	r.decorators = append(r.decorators, routeDecorator{match, decorator})
+	for _, route := range r.routes {
+		if match(route.method, route.path) {
+			route.update()
+		}
+	}
+}
+
+// UseFor wraps the handles of all routes whose path, as it was registered,
+// starts with the given prefix with the given middleware, e.g. to require
+// authentication for all routes below /admin/. It is a shortcut for Decorate
+// with a prefix match. Like Decorate, it also applies to the routes which
+// were registered before the call, whose handles are wrapped anew.
+func (r *Router) UseFor(prefix string, middleware func(Handle) Handle) {
+	r.Decorate(func(_, path string) bool {
+		return strings.HasPrefix(path, prefix)
+	}, middleware)
 }
 
 // Handler is an adapter which allows the usage of an http.Handler as a
 // request handle.
-// The Params are available in the request context under ParamsKey.
+// The Params are available in the request context under ParamsKey, or the
+// ContextKey of the router, if set.
 func (r *Router) Handler(method, path string, handler http.Handler) {
-	r.Handle(method, path,
+	r.HandlerR(method, path, handler)
+}
+
+// HandlerR is like Handler, but returns the registered Route, see HandleR.
+func (r *Router) HandlerR(method, path string, handler http.Handler) *Route {
+	return r.HandleR(method, path,
 		func(w http.ResponseWriter, req *http.Request, p Params) {
 			if len(p) > 0 {
-				ctx := req.Context()
-				ctx = context.WithValue(ctx, ParamsKey, p)
-				req = req.WithContext(ctx)
+				req = req.WithContext(r.withParams(req.Context(), p))
 			}
 			handler.ServeHTTP(w, req)
 		},
@@ -354,7 +1154,109 @@ func (r *Router) Handler(method, path string, handler http.Handler) {
 // HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
 // request handle.
 func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
-	r.Handler(method, path, handler)
+	r.HandlerR(method, path, handler)
+}
+
+// HandlerFuncR is like HandlerFunc, but returns the registered Route, see
+// HandleR.
+func (r *Router) HandlerFuncR(method, path string, handler http.HandlerFunc) *Route {
+	return r.HandlerR(method, path, handler)
+}
+
+// Any registers a fallback handle, which is called for all requests for which
+// no route matches, regardless of their method and path, e.g. for a proxy
+// passing them on to another server. The handle is called without params, it
+// can read the method and the path from the request.
+// Registered routes take precedence, as do the redirects of the router, the
+// server-wide CONNECT route and the automatic replies to OPTIONS and TRACE
+// requests. The fallback replaces the handling of unmatched requests with 405
+// (Method Not Allowed) and 404 (Not Found), i.e. NotFound and
+// MethodNotAllowed are not called anymore.
+func (r *Router) Any(handle Handle) {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	r.fallback = handle
+}
+
+// Gone registers a handle for the given path and method which replies to
+// requests with http error code 410 (Gone) and no body. It can be used to
+// signal clients that a deprecated endpoint was removed permanently.
+// The returned Route is marked, see Route.Gone.
+func (r *Router) Gone(method, path string) *Route {
+	route := r.HandleR(method, path, r.gone)
+	route.gone = true
+	return route
+}
+
+func (r *Router) gone(w http.ResponseWriter, req *http.Request, _ Params) {
+	if r.errorPages[http.StatusGone] != nil {
+		r.Error(w, req, http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusGone)
+}
+
+// Alias registers a route for the given method and oldPath, which serves the
+// requests like the route matching newPath, e.g. to keep the old path of a
+// renamed endpoint working. The wildcards of newPath are filled with the
+// values of the params of oldPath with the same names, e.g.
+//  router.Alias(http.MethodGet, "/user/:id", "/users/:id", true)
+// makes /user/42 an alias of /users/42.
+// If redirect is true, the requests are redirected to the new path with
+// status code 301 for GET requests and 308 for all other request methods.
+// Otherwise they are dispatched internally to the route matching the new path
+// at the time of the request, which receives the params of its own path and
+// the request URL carrying the new path. The middleware of the router is
+// applied once, by the route of the new path. Requests for which no route
+// matches are answered with 404, see NotFound.
+// It panics if newPath equals oldPath or has a wildcard, for which oldPath has
+// no param.
+func (r *Router) Alias(method, oldPath, newPath string, redirect bool) *Route {
+	if oldPath == newPath {
+		panic("path '" + oldPath + "' can not be an alias of itself")
+	}
+	for path := newPath; ; {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			break
+		}
+		if !hasParam(oldPath, wildcard[1:]) {
+			panic("path '" + oldPath + "' has no param '" + wildcard[1:] + "' for the alias of '" + newPath + "'")
+		}
+		path = path[i+len(wildcard):]
+	}
+
+	route := r.HandleR(method, oldPath, func(w http.ResponseWriter, req *http.Request, ps Params) {
+		path := expandPath(newPath, ps)
+		if redirect {
+			code := http.StatusMovedPermanently
+			if req.Method != http.MethodGet {
+				code = http.StatusPermanentRedirect
+			}
+			r.setPath(req, path)
+			http.Redirect(w, req, req.URL.String(), code)
+			return
+		}
+
+		aliased := *req
+		u := *req.URL
+		aliased.URL = &u
+		r.setPath(&aliased, path)
+		_, leaf, aliasedPs, _ := r.match(&aliased, path)
+		if leaf == nil {
+			r.putParams(aliasedPs)
+			r.notFound(w, &aliased, path)
+			return
+		}
+		r.serveLeaf(w, &aliased, leaf, aliasedPs)
+	})
+	if !redirect {
+		// The middleware is applied by the dispatch of the new path
+		route.middleware = nil
+		route.update()
+	}
+	return route
 }
 
 // ServeFiles serves files from the given file system root.
@@ -364,24 +1266,50 @@ func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
 // "/etc/passwd" would be served.
 // Internally a http.FileServer is used, therefore http.NotFound is used instead
 // of the Router's NotFound handler.
+// Routes for both GET and HEAD requests are registered, the latter are answered
+// with the headers of the file only.
 // To use the operating system's file system implementation,
 // use http.Dir:
 //     router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
 func (r *Router) ServeFiles(path string, root http.FileSystem) {
-	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
-		panic("path must end with /*filepath in path '" + path + "'")
+	if err := r.ServeFilesE(path, root); err != nil {
+		panic(err.Error())
 	}
+}
 
-	fileServer := http.FileServer(root)
+// ServeFilesE is like ServeFiles, but returns an error instead of panicking
+// if the path does not end with "/*filepath", e.g. to report invalid mounts
+// read from a configuration file. Conflicts with registered routes still
+// panic, like for all routes.
+func (r *Router) ServeFilesE(path string, root http.FileSystem) error {
+	if err := checkFilesPath(path); err != nil {
+		return err
+	}
 
-	r.GET(path, func(w http.ResponseWriter, req *http.Request, ps Params) {
-		req.URL.Path = ps.ByName("filepath")
+	fileServer := http.FileServer(root)
+	handle := func(w http.ResponseWriter, req *http.Request, ps Params) {
+		name := ps.ByName("filepath")
+		if r.FileDirIndexNoRedirect && serveDirIndex(w, req, root, name) {
+			return
+		}
+		req.URL.Path = name
 		fileServer.ServeHTTP(w, req)
-	})
+	}
+
+	r.GET(path, handle)
+	r.HEAD(path, handle)
+	return nil
 }
 
 func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
 	if rcv := recover(); rcv != nil {
+		if r.Logger != nil {
+			r.Logger.LogAttrs(req.Context(), slog.LevelError, "panic",
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.Any("panic", rcv),
+			)
+		}
 		r.PanicHandler(w, req, rcv)
 	}
 }
@@ -391,19 +1319,357 @@ func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
 // If the path was found, it returns the handle function and the path parameter
 // values. Otherwise the third return value indicates whether a redirection to
 // the same path with an extra / without the trailing slash should be performed.
+// Routes registered for a host with HostHandle are not looked up.
 func (r *Router) Lookup(method, path string) (Handle, Params, bool) {
+	handle, ps, _, tsr := r.LookupInfo(method, path)
+	return handle, ps, tsr
+}
+
+// MatchKind is the kind of route matched by a path, see Router.LookupInfo.
+type MatchKind uint8
+
+const (
+	// MatchNone means that no route matches the path.
+	MatchNone MatchKind = iota
+	// MatchStatic means that a route without wildcards matches the path.
+	MatchStatic
+	// MatchParam means that a route with named parameters, but without a
+	// catch-all parameter, matches the path.
+	MatchParam
+	// MatchCatchAll means that a route ending with a catch-all parameter
+	// matches the path.
+	MatchCatchAll
+)
+
+func (k MatchKind) String() string {
+	switch k {
+	case MatchNone:
+		return "none"
+	case MatchStatic:
+		return "static"
+	case MatchParam:
+		return "param"
+	case MatchCatchAll:
+		return "catchAll"
+	default:
+		return "invalid"
+	}
+}
+
+// lookup looks up the path in the given tree and records the duration of the
+// lookup, if EnableLookupTiming is set.
+func (r *Router) lookup(root *node, path string) (leaf *node, ps *Params, tsr bool) {
+	if !r.EnableLookupTiming {
+		return root.getValue(path, r.getParams)
+	}
+	start := time.Now()
+	leaf, ps, tsr = root.getValue(path, r.getParams)
+	r.lookupTimings.add(time.Since(start))
+	return leaf, ps, tsr
+}
+
+// LookupInfo is like Lookup, but additionally returns the kind of the matched
+// route, e.g. to analyze how the traffic splits between static and dynamic
+// routes. If the path was not found, the kind is MatchNone.
+func (r *Router) LookupInfo(method, path string) (Handle, Params, MatchKind, bool) {
 	if root := r.trees[method]; root != nil {
-		handle, ps, tsr := root.getValue(path, r.getParams)
-		if handle == nil {
+		leaf, ps, tsr := root.getValue(path, r.getParams)
+		if leaf == nil {
 			r.putParams(ps)
-			return nil, nil, tsr
+			return nil, nil, MatchNone, tsr
+		}
+		if leaf.nType == catchAll {
+			return leaf.handle, *ps, MatchCatchAll, tsr
 		}
 		if ps == nil {
-			return handle, nil, tsr
+			return leaf.handle, nil, MatchStatic, tsr
 		}
-		return handle, *ps, tsr
+		return leaf.handle, *ps, MatchParam, tsr
 	}
-	return nil, nil, false
+	return nil, nil, MatchNone, false
+}
+
+// LookupRequest is like Lookup, but uses the method and path of the given
+// request, as the router matches it, e.g. without the prefix set with
+// StripPrefix. If the path was found, the returned request carries the path
+// parameter values in its context, see ParamsFromContext.
+// Otherwise the given request is returned unchanged.
+func (r *Router) LookupRequest(req *http.Request) (Handle, *http.Request, bool) {
+	path, ok := r.getPath(req)
+	if !ok {
+		return nil, req, false
+	}
+	handle, ps, tsr := r.Lookup(req.Method, path)
+	if handle != nil && len(ps) > 0 {
+		req = req.WithContext(r.withParams(req.Context(), ps))
+	}
+	return handle, req, tsr
+}
+
+// DumpTree writes a readable representation of the tree of the given method to
+// w, which is e.g. useful to debug routing issues. Each line describes one
+// node with its path segment, its type (static, root, param or catchAll) and
+// its priority. Nodes which hold a handle are marked with the path of the
+// respective route. Nothing is written if no route is registered for the
+// method.
+func (r *Router) DumpTree(method string, w io.Writer) {
+	if root := r.trees[method]; root != nil {
+		root.dump(w, "")
+	}
+}
+
+// RecomputePriorities reorders the trees by the expected traffic of the
+// routes. weights maps the paths of the routes, as they were registered, to
+// their weight, e.g. the number of requests in a traffic log. Routes without
+// a weight count as 0. The weight of a path applies to its routes of all
+// methods.
+// By default the children of each node in the trees are ordered by the number
+// of routes below them, so that the lookup tries them first. Afterwards the
+// children are ordered by the sum of the weights of the routes below them
+// instead. This only changes the order in which the children are tried,
+// which path matches which route is unchanged.
+// Routes registered afterwards change the order again, so this should be
+// called after all routes are registered. Like the registration of routes, it
+// is not concurrency-safe.
+func (r *Router) RecomputePriorities(weights map[string]uint32) {
+	for _, root := range r.trees {
+		root.recomputePriorities(weights)
+	}
+}
+
+// Optimize builds an index of the lowercased routes of each method, which
+// speeds up the case-insensitive lookups of RedirectFixedPath, in particular
+// for paths with non-ASCII characters. Since the index costs about as much
+// memory as the routes themselves, it is only built on request.
+// The index of a method is discarded when another route is registered for it,
+// Optimize must then be called again. Like the registration of routes,
+// Optimize is not concurrency-safe.
+func (r *Router) Optimize() {
+	r.caseIndexes = make(map[string]*caseIndex, len(r.trees))
+	for method := range r.trees {
+		var routes []*Route
+		for _, route := range r.routes {
+			if route.method == method && route.path != "*" && route.host == "" {
+				routes = append(routes, route)
+			}
+		}
+		if ci := newCaseIndex(routes); ci != nil {
+			r.caseIndexes[method] = ci
+		}
+	}
+}
+
+// findCaseInsensitivePath makes a case-insensitive lookup of the path in the
+// tree of the given method, using the index built by Optimize if possible.
+func (r *Router) findCaseInsensitivePath(method, path string) (string, bool) {
+	if ci := r.caseIndexes[method]; ci != nil {
+		if fixedPath, found, ok := ci.find(path, r.RedirectTrailingSlash); ok {
+			return fixedPath, found
+		}
+	}
+	return r.trees[method].findCaseInsensitivePath(path, r.RedirectTrailingSlash)
+}
+
+// HandlerByName returns the handle of the route with the given name, see
+// Route.Name, e.g. to call it from another handle without routing the request
+// again. The handle is wrapped by the middleware of the router, like for
+// routed requests. Since no path is matched, the caller must supply the
+// params the handle expects. Disabled routes are not found, see SetEnabled.
+func (r *Router) HandlerByName(name string) (Handle, bool) {
+	route := r.names[name]
+	if route == nil || !route.Enabled() {
+		return nil, false
+	}
+	return route.leaf.handle, true
+}
+
+// Routes returns all registered routes in the order of their registration.
+func (r *Router) Routes() []*Route {
+	routes := make([]*Route, len(r.routes))
+	copy(routes, r.routes)
+	return routes
+}
+
+// RouteError is a problem of a registered route reported by Router.Validate.
+type RouteError struct {
+	Method string
+	Path   string
+	Reason string
+}
+
+func (e *RouteError) Error() string {
+	return "route " + e.Method + " " + e.Path + ": " + e.Reason
+}
+
+// Validate checks all registered routes for problems which are not detected
+// when the routes are registered, since they depend on the configuration of
+// the router or on how clients send requests, and returns them as
+// *RouteError. It is meant as a safety net at startup, e.g. for large
+// generated sets of routes. It reports routes, which can never be matched:
+//   - paths containing a '?' or '#', which are never part of a request path
+//   - paths which are not clean, e.g. /a/../b or /a//b, which clients
+//     usually clean before sending the request, see CleanPath
+//   - methods which are not uppercase if NormalizeMethod is enabled
+// If no problems are found, an empty slice is returned.
+func (r *Router) Validate() []error {
+	errs := []error{}
+	for _, route := range r.routes {
+		if route.path == "*" {
+			continue
+		}
+		fail := func(reason string) {
+			errs = append(errs, &RouteError{route.method, route.path, reason})
+		}
+		if strings.ContainsAny(route.path, "?#") {
+			fail("path contains '?' or '#', which are never part of the request path")
+		}
+		if clean := CleanPath(route.path); clean != route.path {
+			fail("path is not clean, clients request '" + clean + "' instead")
+		}
+		if r.NormalizeMethod && strings.ToUpper(route.method) != route.method {
+			fail("method is not uppercase, but NormalizeMethod is enabled")
+		}
+	}
+	return errs
+}
+
+// SetEnabled disables or re-enables the route registered with the given method
+// and path, e.g. for feature flags. Requests are then handled as if the route
+// was not registered, i.e. answered with 404 or 405, or redirected to another
+// route, while the route and its options are kept for a cheap re-enabling.
+// It panics if no such route is registered. Unlike the registration of routes,
+// it is safe to call while the router serves requests.
+func (r *Router) SetEnabled(method, path string, enabled bool) {
+	for _, route := range r.routes {
+		if route.method == method && route.path == path && route.host == "" {
+			route.leaf.disabled.Store(!enabled)
+			return
+		}
+	}
+	panic("no route registered for " + method + " " + path)
+}
+
+// RouteTree is a node of the tree of registered routes grouped by their path
+// segments, as returned by Router.RouteTree.
+type RouteTree struct {
+	// The path prefix of the node, e.g. /api/v1, which is / for the root.
+	Path string
+
+	// The routes with exactly this path, with or without a trailing slash,
+	// in the order of their registration.
+	Routes []*Route
+
+	// The nodes of the next path segment, sorted by path.
+	Children []*RouteTree
+}
+
+// RouteTree returns all registered routes grouped by their path segments,
+// e.g. to render a navigable tree of a large API in an admin UI. For example
+// the routes /api/v1/users and /api/v1/users/:id are below the nodes /api and
+// /api/v1 in the nodes /api/v1/users and /api/v1/users/:id. The server-wide
+// CONNECT route "*" is part of the root.
+func (r *Router) RouteTree() *RouteTree {
+	root := &RouteTree{Path: "/"}
+	for _, route := range r.routes {
+		t := root
+		if path := strings.Trim(route.path, "/"); path != "" && route.path != "*" {
+			for _, segment := range strings.Split(path, "/") {
+				t = t.child(segment)
+			}
+		}
+		t.Routes = append(t.Routes, route)
+	}
+	root.sort()
+	return root
+}
+
+// child returns the child for the given path segment, which is created if it
+// does not exist yet.
+func (t *RouteTree) child(segment string) *RouteTree {
+	path := strings.TrimSuffix(t.Path, "/") + "/" + segment
+	for _, c := range t.Children {
+		if c.Path == path {
+			return c
+		}
+	}
+	c := &RouteTree{Path: path}
+	t.Children = append(t.Children, c)
+	return c
+}
+
+func (t *RouteTree) sort() {
+	sort.Slice(t.Children, func(i, j int) bool {
+		return t.Children[i].Path < t.Children[j].Path
+	})
+	for _, c := range t.Children {
+		c.sort()
+	}
+}
+
+// Walk calls fn for each registered route in the order of registration, with
+// the method, the path as it was registered and the handle which serves the
+// route, i.e. including the middleware of the router. The handle of a route
+// disabled with SetEnabled is nil. It stops at the first
+// error returned by fn and returns it. Unlike Routes, it does not allocate a
+// list of all routes. Routes registered for a host are walked without it.
+func (r *Router) Walk(fn func(method, path string, handle Handle) error) error {
+	for _, route := range r.routes {
+		var handle Handle
+		if route.Enabled() {
+			handle = route.leaf.handle
+		}
+		if err := fn(route.method, route.path, handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MethodsFor returns the methods for which a route with exactly the given
+// path, e.g. /user/:id, is registered, plus OPTIONS if HandleOPTIONS is
+// enabled. The methods are sorted like in the "Allow" header. If no route is
+// registered for the path, nil is returned.
+func (r *Router) MethodsFor(path string) []string {
+	var methods []string
+	hasOptions := false
+	for _, route := range r.routes {
+		if route.path != path || route.host != "" || !route.Enabled() {
+			continue
+		}
+		methods = append(methods, route.method)
+		if route.method == http.MethodOptions {
+			hasOptions = true
+		}
+	}
+	if methods == nil {
+		return nil
+	}
+	if r.HandleOPTIONS && !hasOptions {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// MaxParamsFor returns the largest number of params of the routes registered
+// for the given method, including the param holding the matched route path,
+// see SaveMatchedRoutePath. It can be used to size the Params of custom
+// dispatch loops, e.g. with Lookup.
+func (r *Router) MaxParamsFor(method string) int {
+	maxParams := 0
+	for _, route := range r.routes {
+		if route.method != method || route.path == "*" {
+			continue
+		}
+		n := int(countParams(route.path))
+		if route.saveMatchedRoutePath {
+			n++
+		}
+		if n > maxParams {
+			maxParams = n
+		}
+	}
+	return maxParams
 }
 
 func (r *Router) allowed(path, reqMethod string) (allow string) {
@@ -429,8 +1695,8 @@ func (r *Router) allowed(path, reqMethod string) (allow string) {
 				continue
 			}
 
-			handle, _, _ := r.trees[method].getValue(path, nil)
-			if handle != nil {
+			leaf, _, _ := r.trees[method].getValue(path, nil)
+			if leaf != nil {
 				// Add request method to list of allowed methods
 				allowed = append(allowed, method)
 			}
@@ -439,7 +1705,7 @@ func (r *Router) allowed(path, reqMethod string) (allow string) {
 
 	if len(allowed) > 0 {
 		// Add request method to list of allowed methods
-		if r.HandleOPTIONS {
+		if r.HandleOPTIONS || (r.IncludeOptionsInAllow && r.hasOptions(path)) {
 			allowed = append(allowed, http.MethodOptions)
 		}
 
@@ -459,24 +1725,99 @@ func (r *Router) allowed(path, reqMethod string) (allow string) {
 	return allow
 }
 
+// hasOptions reports whether a custom OPTIONS handle is registered for the
+// path or, for the path "*", for any path.
+func (r *Router) hasOptions(path string) bool {
+	root := r.trees[http.MethodOptions]
+	if path == "*" {
+		return root != nil
+	}
+	return root != nil && root.matches(path)
+}
+
 // ServeHTTP makes the router implement the http.Handler interface.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.Logger != nil {
+		r.serveLogged(w, req)
+		return
+	}
+	r.serveHTTP(w, req)
+}
+
+// serveHTTP dispatches the request and returns the path of the matched route,
+// if any.
+func (r *Router) serveHTTP(w http.ResponseWriter, req *http.Request) (route string) {
 	if r.PanicHandler != nil {
+		// Record whether the header was written, see HeaderWritten
+		if _, ok := w.(*responseWriter); !ok {
+			w = &responseWriter{ResponseWriter: w}
+		}
 		defer r.recv(w, req)
 	}
 
-	path := req.URL.Path
-
-	if root := r.trees[req.Method]; root != nil {
-		if handle, ps, tsr := root.getValue(path, r.getParams); handle != nil {
-			if ps != nil {
-				handle(w, req, *ps)
-				r.putParams(ps)
-			} else {
-				handle(w, req, nil)
+	if r.DefaultHeaders != nil {
+		header := w.Header()
+		for key, values := range r.DefaultHeaders {
+			header.Del(key)
+			for _, v := range values {
+				header.Add(key, v)
 			}
+		}
+	}
+
+	if r.NormalizeMethod {
+		if method := strings.ToUpper(req.Method); method != req.Method {
+			normalized := *req
+			normalized.Method = method
+			req = &normalized
+		}
+	}
+
+	if r.MaxBodyBytes > 0 && req.Body != nil {
+		// Do not modify the request of the caller, like http.MaxBytesHandler
+		limited := *req
+		limited.Body = http.MaxBytesReader(w, req.Body, r.MaxBodyBytes)
+		req = &limited
+	}
+
+	path, ok := r.getPath(req)
+	if !ok {
+		r.notFound(w, req, "")
+		return
+	}
+
+	if r.RedirectToCanonicalHost && r.redirectToCanonicalHost(w, req, path) {
+		return
+	}
+
+	root, leaf, ps, tsr := r.match(req, path)
+	if leaf == nil && req.Method == http.MethodHead && r.HeadFallsBackToGet && r.trees[http.MethodGet] != nil {
+		r.putParams(ps)
+		root = r.trees[http.MethodGet]
+		leaf, ps, tsr = r.lookup(root, path)
+
+		hw := &headWriter{ResponseWriter: w}
+		r.dispatch(hw, req, path, root, leaf, ps, tsr, &route)
+		hw.finish()
+		return
+	}
+	r.dispatch(w, req, path, root, leaf, ps, tsr, &route)
+	return
+}
+
+// dispatch serves the request with the result of the lookup of the path in
+// the tree root, or answers it as unmatched. The path of the matched route, if
+// any, is stored in route before its handle is called.
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request, path string, root, leaf *node, ps *Params, tsr bool, route *string) {
+	noMatchReported := false
+	if root != nil {
+		if leaf != nil {
+			*route = leaf.fullPath
+			r.serveLeaf(w, req, leaf, ps)
 			return
 		} else if req.Method != http.MethodConnect && path != "/" {
+			noMatchReported = true
+
 			// Moved Permanently, request with GET method
 			code := http.StatusMovedPermanently
 			if req.Method != http.MethodGet {
@@ -484,59 +1825,203 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				code = http.StatusPermanentRedirect
 			}
 
-			if tsr && r.RedirectTrailingSlash {
-				if len(path) > 1 && path[len(path)-1] == '/' {
-					req.URL.Path = path[:len(path)-1]
-				} else {
-					req.URL.Path = path + "/"
+			tsrPath := path + "/"
+			if len(path) > 1 && path[len(path)-1] == '/' {
+				tsrPath = path[:len(path)-1]
+			}
+			redirectTSR := tsr && !r.ExactMatchOnly && (r.RedirectTrailingSlash || r.CatchAllTrailingSlashRedirect && isCatchAllPrefix(root, path)) &&
+				!noTSR(root, tsrPath)
+
+			// Try to fix the request path. The trailing slash is fixed along
+			// with the case and the superfluous path elements, so the client
+			// is redirected to the canonical path with a single redirect.
+			var fixedPath string
+			var found bool
+			if !redirectTSR && r.RedirectFixedPath && !r.ExactMatchOnly {
+				fixedPath, found = r.findCaseInsensitivePath(
+					req.Method,
+					CleanPath(path),
+				)
+				if found && noTSR(root, fixedPath) &&
+					strings.HasSuffix(fixedPath, "/") != strings.HasSuffix(path, "/") {
+					found = false
+				}
+				if !found {
+					fixedPath = ""
 				}
+			}
+
+			if r.OnNoMatch != nil {
+				r.OnNoMatch(req.Method, path, tsr, fixedPath, redirectTSR || found)
+			}
+
+			if redirectTSR {
+				r.setPath(req, tsrPath)
 				http.Redirect(w, req, req.URL.String(), code)
 				return
 			}
 
-			// Try to fix the request path
-			if r.RedirectFixedPath {
-				fixedPath, found := root.findCaseInsensitivePath(
-					CleanPath(path),
-					r.RedirectTrailingSlash,
-				)
-				if found {
-					req.URL.Path = fixedPath
-					http.Redirect(w, req, req.URL.String(), code)
-					return
-				}
+			if found {
+				r.setPath(req, fixedPath)
+				http.Redirect(w, req, req.URL.String(), code)
+				return
 			}
 		}
 	}
 
+	if r.OnNoMatch != nil && !noMatchReported {
+		r.OnNoMatch(req.Method, path, false, "", false)
+	}
+
+	if req.Method == http.MethodTrace && r.EnableTRACE {
+		r.trace(w, req)
+		return
+	}
+
+	if req.Method == http.MethodConnect && r.connect != nil && r.connect.active() {
+		*route = r.connect.fullPath
+		r.connect.handle(w, req, nil)
+		return
+	}
+
 	if req.Method == http.MethodOptions && r.HandleOPTIONS {
 		// Handle OPTIONS requests
 		if allow := r.allowed(path, http.MethodOptions); allow != "" {
 			w.Header().Set("Allow", allow)
+			if origin := req.Header.Get("Origin"); origin != "" && path != "*" {
+				if method := req.Header.Get("Access-Control-Request-Method"); method != "" {
+					if cors := r.corsFor(path, method); cors != nil {
+						cors.setPreflightHeaders(w.Header(), origin, allow)
+					}
+					if r.PreflightMaxAge > 0 {
+						w.Header().Set("Access-Control-Max-Age",
+							strconv.FormatInt(int64(r.PreflightMaxAge/time.Second), 10))
+					}
+				}
+			}
 			if r.GlobalOPTIONS != nil {
 				r.GlobalOPTIONS.ServeHTTP(w, req)
+			} else {
+				if r.OptionsStatusCode != 0 {
+					w.WriteHeader(r.OptionsStatusCode)
+				}
+				if len(r.OptionsBody) > 0 {
+					w.Write(r.OptionsBody)
+				}
 			}
 			return
 		}
-	} else if r.HandleMethodNotAllowed { // Handle 405
+	} else if r.HandleMethodNotAllowed && r.fallback == nil { // Handle 405
 		if allow := r.allowed(path, req.Method); allow != "" {
 			w.Header().Set("Allow", allow)
-			if r.MethodNotAllowed != nil {
+			if handler := r.methodNotAllowedFor(path, req.Method); handler != nil {
+				handler.ServeHTTP(w, req)
+			} else if r.MethodNotAllowed != nil {
 				r.MethodNotAllowed.ServeHTTP(w, req)
 			} else {
-				http.Error(w,
-					http.StatusText(http.StatusMethodNotAllowed),
-					http.StatusMethodNotAllowed,
-				)
+				r.Error(w, req, http.StatusMethodNotAllowed)
 			}
 			return
 		}
 	}
 
+	if r.fallback != nil {
+		r.fallback(w, req, nil)
+		return
+	}
+
 	// Handle 404
-	if r.NotFound != nil {
-		r.NotFound.ServeHTTP(w, req)
+	r.notFound(w, req, path)
+}
+
+// match looks up the path in the tree of the request method, preferring the
+// routes registered for the host of the request. root is the tree of the
+// method, unless a host route matched.
+func (r *Router) match(req *http.Request, path string) (root, leaf *node, ps *Params, tsr bool) {
+	root = r.trees[req.Method]
+	if r.hostTrees != nil {
+		if hostRoot := r.hostTrees[requestHost(req)][req.Method]; hostRoot != nil {
+			if leaf, ps, _ = r.lookup(hostRoot, path); leaf != nil {
+				return hostRoot, leaf, ps, false
+			}
+			r.putParams(ps)
+			ps = nil
+		}
+	}
+	if root != nil {
+		leaf, ps, tsr = r.lookup(root, path)
+	}
+	return root, leaf, ps, tsr
+}
+
+// serveLeaf calls the handle of the matched leaf with the params, after
+// applying the options of the router to them.
+func (r *Router) serveLeaf(w http.ResponseWriter, req *http.Request, leaf *node, ps *Params) {
+	if ps != nil && r.UnescapePathParams && r.KeepEncodedSlash {
+		if !unescapeParams(*ps) {
+			r.putParams(ps)
+			r.Error(w, req, http.StatusBadRequest)
+			return
+		}
+	}
+	if r.CleanCatchAll && leaf.nType == catchAll {
+		p := &(*ps)[len(*ps)-1]
+		p.Value = CleanPath(p.Value)
+	}
+	if r.TrimCatchAllLeadingSlash && leaf.nType == catchAll {
+		p := &(*ps)[len(*ps)-1]
+		p.Value = strings.TrimPrefix(p.Value, "/")
+	}
+	if r.ValueStore {
+		var store *Store
+		req, store = r.withStore(req)
+		defer r.putStore(store)
+	}
+	if ps != nil {
+		leaf.handle(w, req, *ps)
+		r.putParams(ps)
 	} else {
-		http.NotFound(w, req)
+		leaf.handle(w, req, nil)
+	}
+}
+
+// notFound answers a request for which no route matches, see NotFound. path is
+// the path the router matched, which is empty if the request was not matched
+// at all, e.g. because it lacks the prefix set with StripPrefix.
+func (r *Router) notFound(w http.ResponseWriter, req *http.Request, path string) {
+	if r.SuggestRoutes && path != "" {
+		if suggestion := r.suggestRoute(path); suggestion != "" {
+			w.Header().Set("X-Suggested-Route", suggestion)
+		}
+	}
+
+	if r.NotFound != nil {
+		if !r.NotFoundChain {
+			r.NotFound.ServeHTTP(w, req)
+			return
+		}
+
+		rw := &responseWriter{ResponseWriter: w}
+		r.NotFound.ServeHTTP(rw, req)
+		if rw.Written() {
+			return
+		}
 	}
+	r.Error(w, req, http.StatusNotFound)
+}
+
+// serveLogged serves the request and logs it afterwards.
+func (r *Router) serveLogged(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	rw := &responseWriter{ResponseWriter: w}
+
+	route := r.serveHTTP(rw, req)
+
+	r.Logger.LogAttrs(req.Context(), slog.LevelInfo, "request",
+		slog.String("method", req.Method),
+		slog.String("route", route),
+		slog.Int("status", rw.Status()),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("remote_addr", req.RemoteAddr),
+	)
 }
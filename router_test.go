@@ -5,11 +5,18 @@
 package httprouter
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -45,6 +52,177 @@ func TestParams(t *testing.T) {
 	}
 }
 
+func TestParamsLen(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	var params Params
+	router := New()
+	router.GET("/a/:b/:c/:d/:e", handlerFunc)
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		params = ps
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if len(params) != 1 {
+		t.Errorf("Wrong number of params: want 1, got %d", len(params))
+	}
+}
+
+func TestParamsHas(t *testing.T) {
+	ps := Params{
+		Param{"param1", "value1"},
+		Param{"empty", ""},
+	}
+	if !ps.Has("param1") {
+		t.Error("Expected param1 to exist")
+	}
+	if !ps.Has("empty") {
+		t.Error("Expected param with empty value to exist")
+	}
+	if ps.Has("noKey") {
+		t.Error("Expected noKey not to exist")
+	}
+}
+
+func TestParamsLookup(t *testing.T) {
+	ps := Params{
+		Param{"param1", "value1"},
+		Param{"empty", ""},
+		Param{"param1", "value2"},
+	}
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+		def   string
+	}{
+		{"param1", "value1", true, "value1"},
+		{"empty", "", true, "default"},
+		{"noKey", "", false, "default"},
+	}
+	for _, test := range tests {
+		if v, ok := ps.Lookup(test.name); v != test.value || ok != test.ok {
+			t.Errorf("Wrong lookup of %s: want %q, %v; got %q, %v", test.name, test.value, test.ok, v, ok)
+		}
+		if v := ps.ByNameDefault(test.name, "default"); v != test.def {
+			t.Errorf("Wrong value with default for %s: want %q, got %q", test.name, test.def, v)
+		}
+	}
+}
+
+func TestParamsGetAll(t *testing.T) {
+	ps := Params{
+		Param{"param1", "value1"},
+		Param{"param2", "value2"},
+		Param{"param1", "value3"},
+	}
+	if vals := ps.GetAll("param1"); !reflect.DeepEqual(vals, []string{"value1", "value3"}) {
+		t.Errorf("Wrong values for param1: %v", vals)
+	}
+	if vals := ps.GetAll("param2"); !reflect.DeepEqual(vals, []string{"value2"}) {
+		t.Errorf("Wrong values for param2: %v", vals)
+	}
+	if vals := ps.GetAll("noKey"); vals != nil {
+		t.Errorf("Expected nil for not found key; got: %v", vals)
+	}
+}
+
+func TestParamsEncode(t *testing.T) {
+	tests := []struct {
+		ps   Params
+		want string
+	}{
+		{nil, ""},
+		{Params{}, ""},
+		{Params{{"name", "gopher"}}, "name=gopher"},
+		{Params{{"q", "a b&c=d"}, {"filepath", "/dir/file.txt"}}, "filepath=%2Fdir%2Ffile.txt&q=a+b%26c%3Dd"},
+		{Params{{"id", "1"}, {"id", "2"}}, "id=1&id=2"},
+	}
+	for _, test := range tests {
+		if got := test.ps.Encode(); got != test.want {
+			t.Errorf("Wrong encoding of %v: want %q, got %q", test.ps, test.want, got)
+		}
+	}
+}
+
+func TestParamsForEach(t *testing.T) {
+	ps := Params{
+		Param{"param1", "value1"},
+		Param{"param2", "value2"},
+		Param{"param3", "value3"},
+	}
+
+	var got []string
+	ps.ForEach(func(key, value string) bool {
+		got = append(got, key+"="+value)
+		return true
+	})
+	if want := []string{"param1=value1", "param2=value2", "param3=value3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong iteration: want %v, got %v", want, got)
+	}
+
+	got = nil
+	ps.ForEach(func(key, value string) bool {
+		got = append(got, key)
+		return key != "param2"
+	})
+	if want := []string{"param1", "param2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Iteration did not stop: want %v, got %v", want, got)
+	}
+}
+
+func TestParamsCatchAll(t *testing.T) {
+	type catchAll struct {
+		name, value string
+		ok          bool
+	}
+
+	for _, saveMatchedRoutePath := range []bool{false, true} {
+		router := New()
+		router.SaveMatchedRoutePath = saveMatchedRoutePath
+
+		router.KeepEncodedSlash = true
+		router.UnescapePathParams = true
+		router.TrimCatchAllLeadingSlash = true
+
+		var got catchAll
+		handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			got.name, got.value, got.ok = ps.CatchAll()
+		}
+		router.GET("/static/*filepath", handle)
+		router.GET("/user/:name", handle)
+		router.GET("/user/:name/files/*path", handle)
+		router.GET("/star/:name/\\*name", handle)
+		router.GET("/about", handle)
+
+		tests := []struct {
+			path string
+			want catchAll
+		}{
+			{"/static/css/site.css", catchAll{"filepath", "css/site.css", true}},
+			{"/user/gopher/files/a/b", catchAll{"path", "a/b", true}},
+			{"/user/%2Fgopher", catchAll{}},
+			{"/star/gopher/*name", catchAll{}},
+			{"/about", catchAll{}},
+		}
+		for _, test := range tests {
+			got = catchAll{}
+			if !saveMatchedRoutePath {
+				// The path of the matched route is required
+				test.want = catchAll{}
+			}
+			r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusOK || got != test.want {
+				t.Errorf("Wrong catch-all for %s (SaveMatchedRoutePath=%v): want %v, got %d %v",
+					test.path, saveMatchedRoutePath, test.want, w.Code, got)
+			}
+		}
+	}
+}
+
 func TestRouter(t *testing.T) {
 	router := New()
 
@@ -240,6 +418,44 @@ func TestRouterChaining(t *testing.T) {
 	}
 }
 
+func TestRouterNotFoundChain(t *testing.T) {
+	router1 := New()
+	router2 := New()
+	router1.NotFound = router2
+	router1.NotFoundChain = true
+
+	// router2 does not handle requests it can't route
+	router2.NotFound = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+
+	barHit := false
+	router2.POST("/bar", func(w http.ResponseWriter, req *http.Request, _ Params) {
+		barHit = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r, _ := http.NewRequest(http.MethodPost, "/bar", nil)
+	w := httptest.NewRecorder()
+	router1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK && barHit) {
+		t.Errorf("Chained routing failed with router chaining.")
+	}
+
+	r, _ = http.NewRequest(http.MethodPost, "/qax", nil)
+	w = httptest.NewRecorder()
+	router1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound && w.Body.String() == "404 page not found\n") {
+		t.Errorf("NotFound behavior failed with router chaining: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+
+	// without NotFoundChain, the response of the NotFound handler is final
+	router1.NotFoundChain = false
+	w = httptest.NewRecorder()
+	router1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK && w.Body.Len() == 0) {
+		t.Errorf("NotFound behavior failed without chaining: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+}
+
 func BenchmarkAllowed(b *testing.B) {
 	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
 
@@ -357,6 +573,42 @@ func TestRouterOPTIONS(t *testing.T) {
 	}
 }
 
+func TestRouterOptionsStatusCode(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.OptionsStatusCode = http.StatusNoContent
+	router.GET("/path", handlerFunc)
+	router.OPTIONS("/custom", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.GET("/custom", handlerFunc)
+
+	r, _ := http.NewRequest(http.MethodOptions, "/path", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 || w.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Errorf("OPTIONS with status 204 failed: Code=%d, Body=%q, Header=%v", w.Code, w.Body.String(), w.Header())
+	}
+
+	// custom OPTIONS handles take precedence
+	r, _ = http.NewRequest(http.MethodOptions, "/custom", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Custom OPTIONS handle was not used: Code=%d", w.Code)
+	}
+
+	router.OptionsStatusCode = 0
+	router.OptionsBody = []byte("GET, OPTIONS")
+	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "GET, OPTIONS" {
+		t.Errorf("OPTIONS with body failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+}
+
 func TestRouterNotAllowed(t *testing.T) {
 	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
 
@@ -406,6 +658,31 @@ func TestRouterNotAllowed(t *testing.T) {
 	}
 }
 
+func TestRouterHEADNotAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+
+	r, _ := http.NewRequest(http.MethodHead, "/path", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD for GET-only path failed: Code=%d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS" {
+		t.Errorf("Unexpected Allow header: %q", allow)
+	}
+
+	// without HandleMethodNotAllowed the request is not found
+	router.HandleMethodNotAllowed = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("HEAD for GET-only path without HandleMethodNotAllowed failed: Code=%d", w.Code)
+	}
+}
+
 func TestRouterNotFound(t *testing.T) {
 	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
 
@@ -471,6 +748,226 @@ func TestRouterNotFound(t *testing.T) {
 	}
 }
 
+func TestRouterRedirectCanonical(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.GET("/dir/", handlerFunc)
+	router.GET("/user/:name", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+
+	testRoutes := []struct {
+		route    string
+		location string
+	}{
+		{"/PATH/", "/path"},               // case -/
+		{"/Path//", "/path"},              // case and superfluous slash
+		{"/DIR", "/dir/"},                 // case +/
+		{"/dir/../DIR", "/dir/"},          // clean, case +/
+		{"/./PATH/", "/path"},             // clean, case -/
+		{"/USER/gopher/", "/user/gopher"}, // case of static part -/
+		{"/SRC", "/src/"},                 // case of catch-all prefix +/
+		{"/path?q=1", ""},                 // no redirect
+	}
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if tr.location == "" {
+			if w.Code != http.StatusOK {
+				t.Errorf("Unexpected redirect for %s: Code=%d", tr.route, w.Code)
+			}
+			continue
+		}
+		location := w.Header().Get("Location")
+		if w.Code != http.StatusMovedPermanently || location != tr.location {
+			t.Errorf("Redirect of %s failed: Code=%d, Location=%s, want %s", tr.route, w.Code, location, tr.location)
+			continue
+		}
+
+		// the location must be served without any further redirect
+		r, _ = http.NewRequest(http.MethodGet, location, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Redirect of %s to %s needs another redirect: Code=%d, Location=%s", tr.route, location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterCONNECT(t *testing.T) {
+	router := New()
+
+	var routed, proxied bool
+	var host string
+	router.Handle(http.MethodConnect, "/tunnel/", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	})
+	router.Handle(http.MethodConnect, "*", func(w http.ResponseWriter, r *http.Request, ps Params) {
+		if len(ps) != 0 {
+			t.Errorf("unexpected params: %v", ps)
+		}
+		host = r.Host
+		proxied = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Authority-form request target, as sent by proxy clients
+	r := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: "example.com:443"},
+		Host:   "example.com:443",
+		Header: http.Header{},
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !proxied || w.Code != http.StatusOK || host != "example.com:443" {
+		t.Errorf("CONNECT routing failed: proxied=%v, Code=%d, Host=%s", proxied, w.Code, host)
+	}
+
+	// A more specific CONNECT route takes priority
+	proxied = false
+	r, _ = http.NewRequest(http.MethodConnect, "/tunnel/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !routed || proxied {
+		t.Errorf("CONNECT route /tunnel/ was not dispatched: routed=%v, proxied=%v", routed, proxied)
+	}
+
+	// CONNECT requests must not be redirected
+	proxied = false
+	r, _ = http.NewRequest(http.MethodConnect, "/tunnel", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !proxied || w.Code != http.StatusOK {
+		t.Errorf("CONNECT request was not passed to the proxy handle: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	recv := catchPanic(func() {
+		router.Handle(http.MethodConnect, "*", handle)
+	})
+	if recv == nil {
+		t.Error("registering a duplicate CONNECT handle for '*' did not panic")
+	}
+	recv = catchPanic(func() {
+		router.Handle(http.MethodGet, "*", handle)
+	})
+	if recv == nil {
+		t.Error("registering path '*' for method GET did not panic")
+	}
+}
+
+func TestRouterGone(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/v2/users", handlerFunc)
+	router.Gone(http.MethodGet, "/v1/users")
+	router.POST("/v1/users", handlerFunc)
+
+	r, _ := http.NewRequest(http.MethodGet, "/v1/users", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusGone || w.Body.Len() != 0 {
+		t.Errorf("Gone route failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+
+	r, _ = http.NewRequest(http.MethodOptions, "/v1/users", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
+		t.Errorf("Unexpected Allow header for Gone route: %q", allow)
+	}
+
+	routes := router.Routes()
+	want := []struct {
+		method, path string
+		gone         bool
+	}{
+		{http.MethodGet, "/v2/users", false},
+		{http.MethodGet, "/v1/users", true},
+		{http.MethodPost, "/v1/users", false},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("Routes returned %d routes, want %d", len(routes), len(want))
+	}
+	for i, route := range routes {
+		if route.Method() != want[i].method || route.Path() != want[i].path || route.Gone() != want[i].gone {
+			t.Errorf("Wrong route %d: %s %s gone=%v", i, route.Method(), route.Path(), route.Gone())
+		}
+	}
+}
+
+func TestRouterMethodsFor(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.PUT("/user/:id", handlerFunc)
+	router.GET("/user/:id", handlerFunc)
+	router.DELETE("/user/:id", handlerFunc)
+	router.GET("/users/new", handlerFunc)
+	router.POST("/user", handlerFunc)
+	router.OPTIONS("/user", handlerFunc)
+
+	tests := []struct {
+		path    string
+		methods []string
+	}{
+		{"/user/:id", []string{"DELETE", "GET", "OPTIONS", "PUT"}},
+		{"/users/new", []string{"GET", "OPTIONS"}},
+		{"/user", []string{"OPTIONS", "POST"}},
+		{"/user/1", nil},
+	}
+	for _, test := range tests {
+		if methods := router.MethodsFor(test.path); !reflect.DeepEqual(methods, test.methods) {
+			t.Errorf("Wrong methods for %s: want %v, got %v", test.path, test.methods, methods)
+		}
+	}
+
+	router.HandleOPTIONS = false
+	if methods := router.MethodsFor("/users/new"); !reflect.DeepEqual(methods, []string{"GET"}) {
+		t.Errorf("Wrong methods without HandleOPTIONS: %v", methods)
+	}
+}
+
+func TestRouterDefaultHeaders(t *testing.T) {
+	router := New()
+	router.DefaultHeaders = http.Header{}
+	router.DefaultHeaders.Set("X-Content-Type-Options", "nosniff")
+	router.DefaultHeaders.Set("X-Frame-Options", "DENY")
+	router.GET("/path", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	})
+
+	testRoutes := []struct {
+		method string
+		route  string
+		code   int
+		frame  string
+	}{
+		{http.MethodGet, "/path", http.StatusOK, "SAMEORIGIN"},
+		{http.MethodGet, "/nope", http.StatusNotFound, "DENY"},
+		{http.MethodPost, "/path", http.StatusMethodNotAllowed, "DENY"},
+		{http.MethodGet, "/path/", http.StatusMovedPermanently, "DENY"},
+	}
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(tr.method, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code {
+			t.Errorf("Routing %s %s failed: Code=%d", tr.method, tr.route, w.Code)
+		}
+		if v := w.Header().Get("X-Content-Type-Options"); v != "nosniff" {
+			t.Errorf("Missing default header for %s %s: %q", tr.method, tr.route, v)
+		}
+		if v := w.Header().Get("X-Frame-Options"); v != tr.frame {
+			t.Errorf("Wrong X-Frame-Options header for %s %s: want %q, got %q", tr.method, tr.route, tr.frame, v)
+		}
+	}
+}
+
 func TestRouterPanicHandler(t *testing.T) {
 	router := New()
 	panicHandled := false
@@ -499,28 +996,90 @@ func TestRouterPanicHandler(t *testing.T) {
 	}
 }
 
-func TestRouterLookup(t *testing.T) {
-	routed := false
-	wantHandle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
-		routed = true
+func TestRouterPanicHandlerHeaderWritten(t *testing.T) {
+	router := New()
+	var headerWritten bool
+	router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		headerWritten = HeaderWritten(w)
+		if !headerWritten {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 	}
-	wantParams := Params{Param{"name", "gopher"}}
+	router.GET("/early", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+	router.GET("/late", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("oops!")
+	})
 
-	router := New()
+	r, _ := http.NewRequest(http.MethodGet, "/early", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if headerWritten || w.Code != http.StatusInternalServerError {
+		t.Errorf("Panic before writing the header failed: headerWritten=%v, Code=%d", headerWritten, w.Code)
+	}
 
-	// try empty router first
-	handle, _, tsr := router.Lookup(http.MethodGet, "/nope")
-	if handle != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	r, _ = http.NewRequest(http.MethodGet, "/late", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !headerWritten || w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("Panic after writing the header failed: headerWritten=%v, Code=%d, Body=%q", headerWritten, w.Code, w.Body.String())
 	}
-	if tsr {
-		t.Error("Got wrong TSR recommendation!")
+
+	if HeaderWritten(httptest.NewRecorder()) {
+		t.Error("HeaderWritten reported true for an unknown ResponseWriter")
 	}
+}
 
-	// insert route and try again
-	router.GET("/user/:name", wantHandle)
-	handle, params, _ := router.Lookup(http.MethodGet, "/user/gopher")
-	if handle == nil {
+func TestRouterPanicHandlerResponseWriter(t *testing.T) {
+	router := New()
+	router.PanicHandler = func(_ http.ResponseWriter, _ *http.Request, _ interface{}) {}
+	router.GET("/file", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		if _, ok := w.(http.Pusher); !ok {
+			t.Error("http.Pusher is hidden by the wrapped ResponseWriter")
+		}
+		rf, ok := w.(io.ReaderFrom)
+		if !ok {
+			t.Fatal("io.ReaderFrom is hidden by the wrapped ResponseWriter")
+		}
+		rf.ReadFrom(strings.NewReader("content"))
+		if !HeaderWritten(w) {
+			t.Error("ReadFrom did not record the written header")
+		}
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/file", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Body.String() != "content" {
+		t.Errorf("Wrong body: %q", w.Body.String())
+	}
+}
+
+func TestRouterLookup(t *testing.T) {
+	routed := false
+	wantHandle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	}
+	wantParams := Params{Param{"name", "gopher"}}
+
+	router := New()
+
+	// try empty router first
+	handle, _, tsr := router.Lookup(http.MethodGet, "/nope")
+	if handle != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	}
+	if tsr {
+		t.Error("Got wrong TSR recommendation!")
+	}
+
+	// insert route and try again
+	router.GET("/user/:name", wantHandle)
+	handle, params, _ := router.Lookup(http.MethodGet, "/user/gopher")
+	if handle == nil {
 		t.Fatal("Got no handle!")
 	} else {
 		handle(nil, nil, nil)
@@ -565,6 +1124,35 @@ func TestRouterLookup(t *testing.T) {
 	}
 }
 
+func TestRouterDumpTree(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/", handlerFunc)
+	router.GET("/cmd/:tool/", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+
+	var buf bytes.Buffer
+	router.DumpTree(http.MethodGet, &buf)
+	want := `/ [root, prio 3] -> /
+  cmd/ [static, prio 1]
+    :tool [param, prio 1]
+      / [static, prio 1] -> /cmd/:tool/
+  src [static, prio 1]
+    "" [catchAll, prio 1]
+      /*filepath [catchAll, prio 1] -> /src/*filepath
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Wrong tree dump:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	router.DumpTree(http.MethodPost, &buf)
+	if buf.Len() != 0 {
+		t.Errorf("Got tree dump for method without routes: %s", buf.String())
+	}
+}
+
 func TestRouterParamsFromContext(t *testing.T) {
 	routed := false
 
@@ -610,6 +1198,57 @@ func TestRouterParamsFromContext(t *testing.T) {
 	}
 }
 
+func TestRouterContextKey(t *testing.T) {
+	type otherKey struct{}
+
+	var params, defaultParams Params
+	router := New()
+	router.ContextKey = otherKey{}
+	router.HandlerFunc(http.MethodGet, "/user/:name", func(_ http.ResponseWriter, req *http.Request) {
+		params = ParamsFromContext(req.Context(), otherKey{})
+		defaultParams = ParamsFromContext(req.Context())
+	})
+	router.NewGroup("/group").With(func(next http.Handler) http.Handler {
+		return next
+	}).GET("/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		params = ps
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(params, want) {
+		t.Errorf("Wrong params under ContextKey: want %v, got %v", want, params)
+	}
+	if defaultParams != nil {
+		t.Errorf("Params stored under ParamsKey: %v", defaultParams)
+	}
+
+	params = nil
+	r, _ = http.NewRequest(http.MethodGet, "/group/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(params, want) {
+		t.Errorf("Wrong params in group: want %v, got %v", want, params)
+	}
+}
+
+func TestNewRequestWithParams(t *testing.T) {
+	ps := Params{Param{"name", "gopher"}}
+	req := NewRequestWithParams(http.MethodPost, "/user/gopher", bytes.NewBufferString("body"), ps)
+	if req.Method != http.MethodPost || req.URL.Path != "/user/gopher" {
+		t.Errorf("Wrong request: %s %s", req.Method, req.URL.Path)
+	}
+	if !reflect.DeepEqual(ParamsFromContext(req.Context()), ps) {
+		t.Errorf("Wrong params in context: %v", ParamsFromContext(req.Context()))
+	}
+
+	recv := catchPanic(func() {
+		NewRequestWithParams("bad method", "/", nil, ps)
+	})
+	if recv == nil {
+		t.Error("creating a request with an invalid method did not panic")
+	}
+}
+
 func TestRouterMatchedRoutePath(t *testing.T) {
 	route1 := "/user/:name"
 	routed1 := false
@@ -697,3 +1336,1462 @@ func TestRouterServeFiles(t *testing.T) {
 		t.Error("serving file failed")
 	}
 }
+
+func TestRouterServeFilesHEAD(t *testing.T) {
+	dir := createFiles(t, "favicon.ico")
+
+	router := New()
+	router.ServeFiles("/*filepath", http.Dir(dir))
+
+	r, _ := http.NewRequest(http.MethodHead, "/favicon.ico", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("HEAD request failed: Code=%d", w.Code)
+	}
+	if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(len("favicon.ico")) {
+		t.Errorf("Wrong Content-Length: %q", cl)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Unexpected body: %q", w.Body.String())
+	}
+}
+
+func TestRouterServeFilesE(t *testing.T) {
+	dir := createFiles(t, "a.txt")
+	router := New()
+
+	var err error
+	recv := catchPanic(func() {
+		err = router.ServeFilesE("/noFilepath", http.Dir(dir))
+	})
+	if recv != nil {
+		t.Fatalf("Invalid path panicked: %v", recv)
+	}
+	if want := "path must end with /*filepath in path '/noFilepath'"; err == nil || err.Error() != want {
+		t.Errorf("Wrong error for invalid path: %v", err)
+	}
+	if len(router.Routes()) != 0 {
+		t.Error("Routes were registered for an invalid path")
+	}
+
+	if err := router.ServeFilesE("/files/*filepath", http.Dir(dir)); err != nil {
+		t.Fatalf("Valid path failed: %v", err)
+	}
+	r, _ := http.NewRequest(http.MethodGet, "/files/a.txt", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "a.txt" {
+		t.Errorf("Serving files failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestRouterKeepEncodedSlash(t *testing.T) {
+	var name string
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		name = ps.ByName("name")
+	}
+
+	router := New()
+	router.GET("/files/:name", handle)
+
+	// decoded (default): %2F splits the segment
+	r, _ := http.NewRequest(http.MethodGet, "/files/a%2Fb", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Decoded routing failed: Code=%d, name=%q", w.Code, name)
+	}
+
+	// the zero value of the router also matches against the decoded path
+	zero := &Router{}
+	zero.GET("/files/:name", handle)
+	r, _ = http.NewRequest(http.MethodGet, "/files/a%2Fb", nil)
+	w = httptest.NewRecorder()
+	zero.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Decoded routing of the zero value failed: Code=%d, name=%q", w.Code, name)
+	}
+
+	// escaped: %2F is kept as part of the param value
+	router.KeepEncodedSlash = true
+	r, _ = http.NewRequest(http.MethodGet, "/files/a%2Fb", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || name != "a%2Fb" {
+		t.Errorf("Escaped routing failed: Code=%d, name=%q", w.Code, name)
+	}
+
+	// redirects must keep the encoded slash
+	r, _ = http.NewRequest(http.MethodGet, "/files/a%2Fb/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/files/a%2Fb" {
+		t.Errorf("Escaped redirect failed: Code=%d, Location=%q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRouterPathExtractor(t *testing.T) {
+	var routed string
+	router := New()
+	router.PathExtractor = func(req *http.Request) string {
+		if path := req.Header.Get("X-Forwarded-Path"); path != "" {
+			return path
+		}
+		return req.URL.EscapedPath()
+	}
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = ps.ByName("name")
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/internal", nil)
+	r.Header.Set("X-Forwarded-Path", "/user/gopher")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || routed != "gopher" {
+		t.Errorf("Routing with PathExtractor failed: Code=%d, name=%q", w.Code, routed)
+	}
+
+	// redirects are based on the extracted path
+	testRoutes := []struct {
+		path     string
+		location string
+	}{
+		{"/user/gopher/", "/user/gopher"}, // TSR
+		{"/USER/gopher", "/user/gopher"},  // Fixed Case
+	}
+	for _, tr := range testRoutes {
+		r, _ = http.NewRequest(http.MethodGet, "/internal", nil)
+		r.Header.Set("X-Forwarded-Path", tr.path)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if location := w.Header().Get("Location"); w.Code != http.StatusMovedPermanently || location != tr.location {
+			t.Errorf("Redirect of %s failed: Code=%d, Location=%s", tr.path, w.Code, location)
+		}
+	}
+
+	// the extracted path is also used by LookupRequest
+	r, _ = http.NewRequest(http.MethodGet, "/internal", nil)
+	r.Header.Set("X-Forwarded-Path", "/user/gopher")
+	if handle, _, _ := router.LookupRequest(r); handle == nil {
+		t.Error("LookupRequest did not use the PathExtractor")
+	}
+}
+
+func TestRouterLookupRequest(t *testing.T) {
+	routed := false
+	wantParams := Params{Param{"name", "gopher"}}
+
+	router := New()
+	router.GET("/user/:name", func(_ http.ResponseWriter, req *http.Request, _ Params) {
+		routed = true
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	handle, req, tsr := router.LookupRequest(r)
+	if handle == nil {
+		t.Fatal("Got no handle!")
+	}
+	if tsr {
+		t.Error("Got wrong TSR recommendation!")
+	}
+	if params := ParamsFromContext(req.Context()); !reflect.DeepEqual(params, wantParams) {
+		t.Fatalf("Wrong parameter values: want %v, got %v", wantParams, params)
+	}
+	handle(nil, req, nil)
+	if !routed {
+		t.Fatal("Routing failed!")
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/user/gopher/", nil)
+	handle, req, tsr = router.LookupRequest(r)
+	if handle != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	}
+	if !tsr {
+		t.Error("Got no TSR recommendation!")
+	}
+	if req != r {
+		t.Error("Got modified request for unregistered pattern")
+	}
+}
+
+func TestCatchAllPrefix(t *testing.T) {
+	var prefix string
+	handlerFunc := func(_ http.ResponseWriter, req *http.Request) {
+		prefix = CatchAllPrefix(req)
+	}
+
+	router := New()
+	router.HandlerFunc(http.MethodGet, "/nope/*rest", handlerFunc)
+	router.SaveMatchedRoutePath = true
+	router.HandlerFunc(http.MethodGet, "/proxy/*rest", handlerFunc)
+	router.HandlerFunc(http.MethodGet, "/user/:id/files/*filepath", handlerFunc)
+	router.HandlerFunc(http.MethodGet, "/user/:id", handlerFunc)
+	router.HandlerFunc(http.MethodGet, "/files/C\\:/*p", handlerFunc)
+	router.HandlerFunc(http.MethodGet, "/ns/::sys/*p", handlerFunc)
+
+	testRoutes := []struct {
+		route  string
+		prefix string
+	}{
+		{"/proxy/", "/proxy"},
+		{"/files/C:/a.txt", "/files/C:"},
+		{"/ns/:sys/a", "/ns/:sys"},
+		{"/proxy/a/b", "/proxy"},
+		{"/user/gopher/files/a.txt", "/user/gopher/files"},
+		{"/user/gopher", ""}, // no catch-all
+		{"/nope/a", ""},      // matched route path not saved
+	}
+	for _, tr := range testRoutes {
+		prefix = "unset"
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if prefix != tr.prefix {
+			t.Errorf("Wrong catch-all prefix for %s: want %q, got %q", tr.route, tr.prefix, prefix)
+		}
+	}
+}
+
+func TestRouterLogger(t *testing.T) {
+	var buf bytes.Buffer
+	router := New()
+	router.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.GET("/user/:name", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+
+	testRoutes := []struct {
+		method string
+		route  string
+		status int
+		lines  []map[string]interface{}
+	}{
+		{http.MethodGet, "/user/gopher", http.StatusTeapot, []map[string]interface{}{
+			{"level": "INFO", "msg": "request", "method": "GET", "route": "/user/:name", "status": 418.0},
+		}},
+		{http.MethodGet, "/nope", http.StatusNotFound, []map[string]interface{}{
+			{"level": "INFO", "msg": "request", "method": "GET", "route": "", "status": 404.0},
+		}},
+		{http.MethodPost, "/panic", http.StatusMethodNotAllowed, []map[string]interface{}{
+			{"level": "INFO", "msg": "request", "method": "POST", "route": "", "status": 405.0},
+		}},
+		{http.MethodGet, "/panic", http.StatusInternalServerError, []map[string]interface{}{
+			{"level": "ERROR", "msg": "panic", "method": "GET", "panic": "oops!"},
+			{"level": "INFO", "msg": "request", "method": "GET", "route": "/panic", "status": 500.0},
+		}},
+	}
+	for _, tr := range testRoutes {
+		buf.Reset()
+		r, _ := http.NewRequest(tr.method, tr.route, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.status {
+			t.Errorf("Wrong status for %s %s: want %d, got %d", tr.method, tr.route, tr.status, w.Code)
+		}
+
+		dec := json.NewDecoder(&buf)
+		for _, want := range tr.lines {
+			var line map[string]interface{}
+			if err := dec.Decode(&line); err != nil {
+				t.Fatalf("Missing log line for %s %s: %v", tr.method, tr.route, err)
+			}
+			for k, v := range want {
+				if line[k] != v {
+					t.Errorf("Wrong log attribute %s for %s %s: want %v, got %v", k, tr.method, tr.route, v, line[k])
+				}
+			}
+			if want["msg"] == "request" {
+				if line["remote_addr"] != r.RemoteAddr {
+					t.Errorf("Wrong remote address logged: %v", line["remote_addr"])
+				}
+				if _, ok := line["duration"]; !ok {
+					t.Error("No duration logged")
+				}
+			}
+		}
+		if dec.More() {
+			t.Errorf("Unexpected log lines for %s %s", tr.method, tr.route)
+		}
+	}
+}
+
+func TestRouterUnescapePathParams(t *testing.T) {
+	var ps Params
+	handle := func(_ http.ResponseWriter, _ *http.Request, p Params) {
+		ps = append(Params(nil), p...)
+	}
+
+	router := New()
+	router.KeepEncodedSlash = true
+	router.UnescapePathParams = true
+	router.GET("/search/:q", handle)
+	router.GET("/files/*filepath", handle)
+
+	testRoutes := []struct {
+		route string
+		code  int
+		ps    Params
+	}{
+		{"/search/hello%20world", http.StatusOK, Params{Param{"q", "hello world"}}},
+		{"/search/a%2Fb", http.StatusOK, Params{Param{"q", "a/b"}}},
+		{"/files/a%20b/c%3F", http.StatusOK, Params{Param{"filepath", "/a b/c?"}}},
+		{"/search/%25zz", http.StatusOK, Params{Param{"q", "%zz"}}},
+	}
+	for _, tr := range testRoutes {
+		ps = nil
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.URL.RawPath = tr.route
+		r.URL.Path, _ = url.PathUnescape(tr.route)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code {
+			t.Errorf("Wrong status for %s: want %d, got %d", tr.route, tr.code, w.Code)
+		}
+		if !reflect.DeepEqual(ps, tr.ps) {
+			t.Errorf("Wrong parameter values for %s: want %v, got %v", tr.route, tr.ps, ps)
+		}
+	}
+
+	// invalid escapes are already rejected by the net/http server and
+	// url.URL.EscapedPath, thus test this case directly
+	if unescapeParams(Params{Param{"q", "%zz"}}) {
+		t.Error("Invalid escape not detected")
+	}
+
+	// disabled
+	router.UnescapePathParams = false
+	r, _ := http.NewRequest(http.MethodGet, "/search/hello%20world", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := (Params{Param{"q", "hello%20world"}}); !reflect.DeepEqual(ps, want) {
+		t.Errorf("Wrong parameter values: want %v, got %v", want, ps)
+	}
+}
+
+func TestRouterCleanCatchAll(t *testing.T) {
+	var filepath string
+	router := New()
+	router.GET("/files/*filepath", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		filepath = ps.ByName("filepath")
+	})
+
+	testRoutes := []struct {
+		route string
+		raw   string
+		clean string
+	}{
+		{"/files/", "/", "/"},
+		{"/files/a/b.txt", "/a/b.txt", "/a/b.txt"},
+		{"/files/../../etc/passwd", "/../../etc/passwd", "/etc/passwd"},
+		{"/files/a/../../../etc/passwd", "/a/../../../etc/passwd", "/etc/passwd"},
+		{"/files/a/./b/../c/", "/a/./b/../c/", "/a/c/"},
+		{"/files//a", "//a", "/a"},
+	}
+	for _, clean := range []bool{false, true} {
+		router.CleanCatchAll = clean
+		for _, tr := range testRoutes {
+			want := tr.raw
+			if clean {
+				want = tr.clean
+			}
+			r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+			router.ServeHTTP(new(mockResponseWriter), r)
+			if filepath != want {
+				t.Errorf("Wrong catch-all value for %s (CleanCatchAll=%t): want %q, got %q", tr.route, clean, want, filepath)
+			}
+		}
+	}
+}
+
+func TestRouterMaxBodyBytes(t *testing.T) {
+	router := New()
+	router.MaxBodyBytes = 4
+	router.POST("/upload", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		body, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write(body)
+	})
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{"ok", http.StatusOK},
+		{"1234", http.StatusOK},
+		{"12345", http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodPost, "/upload", strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Wrong status for body %q: want %d, got %d", test.body, test.code, w.Code)
+		}
+	}
+
+	// requests without a body are not affected
+	router.GET("/nobody", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		if r.Body != nil {
+			t.Error("Body was added to a request without a body")
+		}
+	})
+	r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/nobody"}}
+	router.ServeHTTP(httptest.NewRecorder(), r)
+}
+
+func TestRouterTrimCatchAllLeadingSlash(t *testing.T) {
+	var filepath string
+	router := New()
+	router.GET("/static/*filepath", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		filepath = ps.ByName("filepath")
+	})
+
+	testRoutes := []struct {
+		route   string
+		raw     string
+		trimmed string
+	}{
+		{"/static/", "/", ""},
+		{"/static/css/app.css", "/css/app.css", "css/app.css"},
+		{"/static//a", "//a", "/a"},
+	}
+	for _, trim := range []bool{false, true} {
+		router.TrimCatchAllLeadingSlash = trim
+		for _, tr := range testRoutes {
+			want := tr.raw
+			if trim {
+				want = tr.trimmed
+			}
+			r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+			router.ServeHTTP(new(mockResponseWriter), r)
+			if filepath != want {
+				t.Errorf("Wrong catch-all value for %s (TrimCatchAllLeadingSlash=%t): want %q, got %q", tr.route, trim, want, filepath)
+			}
+		}
+	}
+}
+
+func TestHandleToHTTPHandler(t *testing.T) {
+	var params Params
+	routed := false
+	handle := Handle(func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		params = ps
+		routed = true
+	})
+
+	router := New()
+	router.Handler(http.MethodGet, "/user/:name", handle.ToHTTPHandler())
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := (Params{Param{"name", "gopher"}}); !routed || !reflect.DeepEqual(params, want) {
+		t.Errorf("Wrong params: want %v, got %v", want, params)
+	}
+
+	// no params in the context
+	routed = false
+	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	handle.ToHTTPHandler().ServeHTTP(httptest.NewRecorder(), r)
+	if !routed || params != nil {
+		t.Errorf("Wrong params without context: %v", params)
+	}
+
+	// params stored under another key
+	type otherKey struct{}
+	router = New()
+	router.ContextKey = otherKey{}
+	router.Handler(http.MethodGet, "/user/:name", handle.ToHTTPHandler(otherKey{}))
+	r, _ = http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(params, want) {
+		t.Errorf("Wrong params under ContextKey: want %v, got %v", want, params)
+	}
+}
+
+func TestRouterCatchAllTrailingSlashRedirect(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.RedirectTrailingSlash = false
+	router.CatchAllTrailingSlashRedirect = true
+	router.GET("/files/*filepath", handlerFunc)
+	router.GET("/dir/", handlerFunc)
+	router.POST("/upload/*filepath", handlerFunc)
+
+	testRoutes := []struct {
+		method   string
+		route    string
+		code     int
+		location string
+	}{
+		{http.MethodGet, "/files", http.StatusMovedPermanently, "/files/"},
+		{http.MethodPost, "/upload", http.StatusPermanentRedirect, "/upload/"},
+		{http.MethodGet, "/files/", http.StatusOK, ""},
+		{http.MethodGet, "/dir", http.StatusNotFound, ""}, // no catch-all route
+	}
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(tr.method, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || w.Header().Get("Location") != tr.location {
+			t.Errorf("Wrong response for %s %s: want %d %q, got %d %q",
+				tr.method, tr.route, tr.code, tr.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	router.CatchAllTrailingSlashRedirect = false
+	r, _ := http.NewRequest(http.MethodGet, "/files", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Redirect despite disabled option: Code=%d", w.Code)
+	}
+}
+
+func TestRouterLookupInfo(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/", handlerFunc)
+	router.GET("/users", handlerFunc)
+	router.GET("/user/:name", handlerFunc)
+	router.GET("/user/:name/profile", handlerFunc)
+	router.GET("/files/*filepath", handlerFunc)
+
+	tests := []struct {
+		path   string
+		kind   MatchKind
+		params Params
+	}{
+		{"/", MatchStatic, nil},
+		{"/users", MatchStatic, nil},
+		{"/user/gopher", MatchParam, Params{{"name", "gopher"}}},
+		{"/user/gopher/profile", MatchParam, Params{{"name", "gopher"}}},
+		{"/files/a/b", MatchCatchAll, Params{{"filepath", "/a/b"}}},
+		{"/nope", MatchNone, nil},
+	}
+	for _, test := range tests {
+		handle, ps, kind, _ := router.LookupInfo(http.MethodGet, test.path)
+		if kind != test.kind || (handle == nil) != (kind == MatchNone) || !reflect.DeepEqual(ps, test.params) {
+			t.Errorf("Wrong match for %s: want %v %v, got %v %v (handle=%t)",
+				test.path, test.kind, test.params, kind, ps, handle != nil)
+		}
+	}
+
+	if _, _, kind, _ := router.LookupInfo(http.MethodPost, "/users"); kind != MatchNone {
+		t.Errorf("Wrong match for unknown method: %v", kind)
+	}
+}
+
+func TestRouterRecomputePriorities(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	paths := []string{
+		"/admin/users",
+		"/admin/settings",
+		"/admin/logs",
+		"/api/:version/items",
+		"/blog/*post",
+	}
+
+	router := New()
+	for _, path := range paths {
+		router.GET(path, handlerFunc)
+	}
+	childPaths := func(n *node) string {
+		var s []string
+		for _, child := range n.children {
+			s = append(s, child.path)
+		}
+		return strings.Join(s, ",")
+	}
+
+	root := router.trees[http.MethodGet]
+	a := root.children[0]
+	admin := a.children[0]
+	if got, want := childPaths(root)+" "+childPaths(a), "a,blog dmin/,pi/"; got != want {
+		t.Fatalf("Unexpected order before recomputing: want %s, got %s", want, got)
+	}
+
+	router.RecomputePriorities(map[string]uint32{
+		"/blog/*post":         1000,
+		"/api/:version/items": 500,
+		"/admin/logs":         20,
+		"/admin/settings":     1,
+	})
+	if got, want := childPaths(root), "blog,a"; got != want {
+		t.Errorf("Wrong order of the root: want %s, got %s", want, got)
+	}
+	if got, want := childPaths(a), "pi/,dmin/"; got != want {
+		t.Errorf("Wrong order of /a: want %s, got %s", want, got)
+	}
+	if got, want := childPaths(admin), "logs,settings,users"; got != want {
+		t.Errorf("Wrong order of /admin/: want %s, got %s", want, got)
+	}
+	if root.priority != 1521 || a.priority != 521 || admin.priority != 21 {
+		t.Errorf("Wrong priorities: root %d, /a %d, /admin/ %d", root.priority, a.priority, admin.priority)
+	}
+
+	tests := map[string]string{
+		"/admin/users":     "/admin/users",
+		"/admin/settings":  "/admin/settings",
+		"/admin/logs":      "/admin/logs",
+		"/api/v1/items":    "/api/:version/items",
+		"/blog/2024/hello": "/blog/*post",
+	}
+	for path, want := range tests {
+		leaf, _, _ := root.getValue(path, nil)
+		if leaf == nil || leaf.fullPath != want {
+			t.Errorf("Wrong route for %s after recomputing: want %s, got %v", path, want, leaf)
+		}
+	}
+	if leaf, _, _ := root.getValue("/admin/nope", nil); leaf != nil {
+		t.Errorf("Unexpected match for /admin/nope: %s", leaf.fullPath)
+	}
+}
+
+func TestRouterWalk(t *testing.T) {
+	var called string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			called = name
+		}
+	}
+
+	router := New()
+	router.GET("/user/:id", handle("user"))
+	router.POST("/user/:id", handle("post"))
+	router.GET("/files/*filepath", handle("files"))
+	router.DELETE(`/a\:b`, handle("escaped"))
+
+	want := []string{
+		"GET /user/:id user",
+		"POST /user/:id post",
+		"GET /files/*filepath files",
+		`DELETE /a\:b escaped`,
+	}
+	var visited []string
+	err := router.Walk(func(method, path string, handle Handle) error {
+		handle(nil, nil, nil)
+		visited = append(visited, method+" "+path+" "+called)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(visited, want) {
+		t.Errorf("Wrong routes visited: want %v, got %v (err=%v)", want, visited, err)
+	}
+
+	errStop := errors.New("stop")
+	visited = nil
+	err = router.Walk(func(method, path string, _ Handle) error {
+		visited = append(visited, method+" "+path)
+		if len(visited) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || len(visited) != 2 {
+		t.Errorf("Walk was not aborted: err=%v, visited %v", err, visited)
+	}
+}
+
+func TestRouterDeepPathFixedPath(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/a/:b/c/*rest", handlerFunc)
+	router.GET("/a/:b/d", handlerFunc)
+
+	// The case-insensitive lookup recurses at most once per node of the
+	// tree, so its depth is bounded by the registered routes, not by the
+	// request path
+	deep := "/A/B/D" + strings.Repeat("/E", 100000)
+	r, _ := http.NewRequest(http.MethodGet, deep, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Deep path was not answered with 404: Code=%d", w.Code)
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/A/b/C"+strings.Repeat("/x", 100000), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("Deep path of a catch-all was not redirected: Code=%d", w.Code)
+	}
+}
+
+func TestRouterSetEnabled(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GETR("/beta/:id", handlerFunc).Name("beta")
+	router.POST("/beta/:id", handlerFunc)
+	router.GET("/stable", handlerFunc)
+
+	serve := func(method, path string) int {
+		r, _ := http.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	router.SetEnabled(http.MethodGet, "/beta/:id", false)
+	if code := serve(http.MethodGet, "/beta/1"); code != http.StatusMethodNotAllowed {
+		t.Errorf("Disabled route was not answered with 405: Code=%d", code)
+	}
+	router.SetEnabled(http.MethodPost, "/beta/:id", false)
+	if code := serve(http.MethodGet, "/beta/1"); code != http.StatusNotFound {
+		t.Errorf("Disabled routes were not answered with 404: Code=%d", code)
+	}
+	if code := serve(http.MethodGet, "/stable"); code != http.StatusOK {
+		t.Errorf("Other route was affected: Code=%d", code)
+	}
+	if _, ok := router.HandlerByName("beta"); ok {
+		t.Error("Disabled route found by name")
+	}
+	if methods := router.MethodsFor("/beta/:id"); methods != nil {
+		t.Errorf("Methods of disabled routes: %v", methods)
+	}
+	router.Walk(func(method, path string, handle Handle) error {
+		if path == "/beta/:id" && handle != nil {
+			t.Errorf("Handle of the disabled route %s %s walked", method, path)
+		}
+		return nil
+	})
+
+	// options set while disabled apply once re-enabled
+	var validated bool
+	router.Routes()[0].Validate(func(Params) error {
+		validated = true
+		return nil
+	})
+	if code := serve(http.MethodGet, "/beta/1"); code != http.StatusNotFound || validated {
+		t.Errorf("Setting an option enabled the route: Code=%d", code)
+	}
+	router.SetEnabled(http.MethodGet, "/beta/:id", true)
+	router.SetEnabled(http.MethodPost, "/beta/:id", true)
+	if code := serve(http.MethodGet, "/beta/1"); code != http.StatusOK || !validated {
+		t.Errorf("Re-enabled route failed: Code=%d, validated=%v", code, validated)
+	}
+	if code := serve(http.MethodPost, "/beta/1"); code != http.StatusOK {
+		t.Errorf("Re-enabled route failed: Code=%d", code)
+	}
+	if !router.Routes()[0].Enabled() {
+		t.Error("Route not reported as enabled")
+	}
+
+	// the path of a disabled route is still taken
+	router.SetEnabled(http.MethodGet, "/stable", false)
+	if recv := catchPanic(func() { router.GET("/stable", handlerFunc) }); recv == nil {
+		t.Error("Registering the path of a disabled route did not panic")
+	}
+
+	if recv := catchPanic(func() { router.SetEnabled(http.MethodGet, "/nope", false) }); recv == nil {
+		t.Error("Disabling an unknown route did not panic")
+	}
+}
+
+func TestRouterSetEnabledWhileServing(t *testing.T) {
+	router := New()
+	router.GET("/beta", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			router.SetEnabled(http.MethodGet, "/beta", i%2 == 1)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		r, _ := http.NewRequest(http.MethodGet, "/beta", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK && w.Code != http.StatusNotFound {
+			t.Fatalf("Unexpected response while toggling the route: Code=%d", w.Code)
+		}
+	}
+	<-done
+}
+
+func TestRouterNormalizeMethod(t *testing.T) {
+	var method string
+	router := New()
+	router.GET("/path", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		method = r.Method
+	})
+
+	r, _ := http.NewRequest("get", "/path", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Lowercase method was routed without NormalizeMethod: Code=%d", w.Code)
+	}
+
+	router.NormalizeMethod = true
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || method != http.MethodGet {
+		t.Errorf("Lowercase method was not normalized: Code=%d, Method=%q", w.Code, method)
+	}
+	if r.Method != "get" {
+		t.Errorf("Request of the caller was modified: Method=%q", r.Method)
+	}
+}
+
+func TestRouterEnableTRACE(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+
+	newRequest := func() *http.Request {
+		r, _ := http.NewRequest(http.MethodTrace, "/path?q=1", strings.NewReader("body"))
+		r.Header.Set("X-Test", "value")
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("TRACE was answered although disabled: Code=%d", w.Code)
+	}
+
+	router.EnableTRACE = true
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+	want := "TRACE /path?q=1 HTTP/1.1\r\nX-Test: value\r\n\r\nbody"
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "message/http" || w.Body.String() != want {
+		t.Errorf("Wrong TRACE echo: Code=%d, Header=%v, Body=%q", w.Code, w.Header(), w.Body.String())
+	}
+
+	// a custom TRACE handle takes priority
+	router.Handle(http.MethodTrace, "/path", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Custom TRACE handle was not used: Code=%d", w.Code)
+	}
+}
+
+func TestRouterValidate(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/user/:name", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+	router.Handle(http.MethodConnect, "*", handlerFunc)
+	if errs := router.Validate(); errs == nil || len(errs) != 0 {
+		t.Fatalf("Unexpected errors for valid routes: %v", errs)
+	}
+
+	router.NormalizeMethod = true
+	router.GET("/search?q", handlerFunc)
+	router.GET("/a/../b", handlerFunc)
+	router.GET("/c//d/", handlerFunc)
+	router.Handle("post", "/e", handlerFunc)
+
+	want := []string{
+		"route GET /search?q: path contains '?' or '#', which are never part of the request path",
+		"route GET /a/../b: path is not clean, clients request '/b' instead",
+		"route GET /c//d/: path is not clean, clients request '/c/d/' instead",
+		"route post /e: method is not uppercase, but NormalizeMethod is enabled",
+	}
+	var got []string
+	for _, err := range router.Validate() {
+		var routeErr *RouteError
+		if !errors.As(err, &routeErr) {
+			t.Errorf("Error is not a *RouteError: %v", err)
+		}
+		got = append(got, err.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong errors:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestRouterRouteTree(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/", handlerFunc)
+	router.GET("/api/v1/users", handlerFunc)
+	router.POST("/api/v1/users", handlerFunc)
+	router.GET("/api/v1/users/:id", handlerFunc)
+	router.GET("/api/v1/items/", handlerFunc)
+	router.GET("/api/v2/users", handlerFunc)
+	router.GET("/api/", handlerFunc)
+	router.GET("/static/*filepath", handlerFunc)
+
+	var dump func(tree *RouteTree, indent string) string
+	dump = func(tree *RouteTree, indent string) string {
+		s := indent + tree.Path
+		for _, route := range tree.Routes {
+			s += " " + route.Method() + " " + route.Path()
+		}
+		s += "\n"
+		for _, child := range tree.Children {
+			s += dump(child, indent+"  ")
+		}
+		return s
+	}
+
+	want := `/ GET /
+  /api GET /api/
+    /api/v1
+      /api/v1/items GET /api/v1/items/
+      /api/v1/users GET /api/v1/users POST /api/v1/users
+        /api/v1/users/:id GET /api/v1/users/:id
+    /api/v2
+      /api/v2/users GET /api/v2/users
+  /static
+    /static/*filepath GET /static/*filepath
+`
+	if got := dump(router.RouteTree(), ""); got != want {
+		t.Errorf("Wrong route tree:\nwant\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestRouterHostGET(t *testing.T) {
+	router := New()
+	handle := func(body string) Handle {
+		return func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			w.Write([]byte(body))
+		}
+	}
+	router.HostGET("a.com", "/x", handle("a"))
+	router.HostGET("B.com", "/x", handle("b"))
+	router.GET("/x", handle("any"))
+	router.GET("/y", handle("y"))
+
+	tests := []struct {
+		host string
+		path string
+		code int
+		body string
+	}{
+		{"a.com", "/x", http.StatusOK, "a"},
+		{"b.com:8080", "/x", http.StatusOK, "b"},
+		{"A.COM", "/x", http.StatusOK, "a"},
+		{"c.com", "/x", http.StatusOK, "any"},
+		{"a.com", "/y", http.StatusOK, "y"},
+		{"a.com", "/z", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("Wrong response for %s%s: want %d %q, got %d %q",
+				test.host, test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	if route := router.Routes()[1]; route.Host() != "b.com" {
+		t.Errorf("Wrong host of the route: %q", route.Host())
+	}
+
+	if recv := catchPanic(func() {
+		router.HostGET("a.com", "/x", handle("again"))
+	}); recv == nil {
+		t.Error("registering a duplicate host route did not panic")
+	}
+}
+
+func TestRequestHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"", ""},
+		{"example.com", "example.com"},
+		{"Example.COM:8080", "example.com"},
+		{"[::1]:8080", "::1"},
+		{"[::1]", "::1"},
+		{"::1", "::1"},
+		{"ÄPFEL.de", "äpfel.de"},
+	}
+	for _, test := range tests {
+		r := &http.Request{Host: test.host}
+		if host := requestHost(r); host != test.want {
+			t.Errorf("Wrong host for %q: want %q, got %q", test.host, test.want, host)
+		}
+	}
+
+	r := &http.Request{Host: "example.com:8080"}
+	if allocs := testing.AllocsPerRun(10, func() { requestHost(r) }); allocs > 0 {
+		t.Errorf("requestHost allocated %v times", allocs)
+	}
+}
+
+func TestRouterMaxParamsFor(t *testing.T) {
+	router := New()
+	router.GET("/", fakeHandler(""))
+	router.GET("/user/:name/files/*filepath", fakeHandler(""))
+	router.GET("/user/:name", fakeHandler(""))
+	router.POST("/user/:name", fakeHandler(""))
+	router.SaveMatchedRoutePath = true
+	router.PUT("/user/:name", fakeHandler(""))
+
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{http.MethodGet, 2},
+		{http.MethodPost, 1},
+		{http.MethodPut, 2},
+		{http.MethodDelete, 0},
+	}
+	for _, test := range tests {
+		if got := router.MaxParamsFor(test.method); got != test.want {
+			t.Errorf("Wrong max params for %s: want %d, got %d", test.method, test.want, got)
+		}
+	}
+}
+
+func TestRouterRedirectToCanonicalHost(t *testing.T) {
+	router := New()
+	router.RedirectToCanonicalHost = true
+	router.CanonicalHost = "www.example.com"
+	router.CanonicalHostExempt = []string{"/healthz"}
+	router.GET("/search", fakeHandler(""))
+	router.GET("/healthz", fakeHandler(""))
+
+	tests := []struct {
+		method   string
+		host     string
+		target   string
+		code     int
+		location string
+	}{
+		{http.MethodGet, "example.com", "/search?q=gopher&page=2", http.StatusMovedPermanently, "http://www.example.com/search?q=gopher&page=2"},
+		{http.MethodPost, "example.com", "/search", http.StatusPermanentRedirect, "http://www.example.com/search"},
+		{http.MethodGet, "WWW.example.com:8080", "/search", http.StatusOK, ""},
+		{http.MethodGet, "example.com", "/healthz", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.target, nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("Wrong response for %s %s%s: want %d %q, got %d %q", test.method, test.host,
+				test.target, test.code, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterRedirectToCanonicalHostPath(t *testing.T) {
+	router := New()
+	router.RedirectToCanonicalHost = true
+	router.CanonicalHostExempt = []string{"/healthz"}
+	router.StripPrefix("/app")
+	router.GET("/healthz", fakeHandler(""))
+	router.GET("/search", fakeHandler(""))
+
+	// without a CanonicalHost nothing is redirected
+	r, _ := http.NewRequest(http.MethodGet, "/app/search", nil)
+	r.Host = "example.com"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Request without a CanonicalHost was redirected: Code=%d, Location=%q",
+			w.Code, w.Header().Get("Location"))
+	}
+
+	// exempt paths are matched without the prefix
+	router.CanonicalHost = "www.example.com"
+	r, _ = http.NewRequest(http.MethodGet, "/app/healthz", nil)
+	r.Host = "example.com"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Exempt path was redirected: Code=%d, Location=%q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRouterOnNoMatch(t *testing.T) {
+	type noMatch struct {
+		method, path string
+		tsr          bool
+		fixedPath    string
+		matched      bool
+	}
+	var got []noMatch
+
+	router := New()
+	router.RedirectTrailingSlash = false
+	router.OnNoMatch = func(method, path string, tsr bool, fixedPath string, matched bool) {
+		got = append(got, noMatch{method, path, tsr, fixedPath, matched})
+	}
+	router.GET("/path", fakeHandler(""))
+
+	for _, path := range []string{"/path", "/path/", "/PATH", "/none"} {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	r, _ := http.NewRequest(http.MethodPost, "/path", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	want := []noMatch{
+		{http.MethodGet, "/path/", true, "", false},
+		{http.MethodGet, "/PATH", false, "/path", true},
+		{http.MethodGet, "/none", false, "", false},
+		{http.MethodPost, "/path", false, "", false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong calls of OnNoMatch:\nwant %v\ngot  %v", want, got)
+	}
+}
+
+func TestRouterStripPrefix(t *testing.T) {
+	router := New()
+	router.StripPrefix("/myapp/")
+	router.GET("/", fakeHandler(""))
+	router.GET("/users/:name", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte(ps.ByName("name")))
+	})
+
+	tests := []struct {
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{"/myapp/users/gopher", http.StatusOK, "gopher", ""},
+		{"/myapp", http.StatusOK, "", ""},
+		{"/myapp/", http.StatusOK, "", ""},
+		{"/myapp/users/gopher/", http.StatusMovedPermanently, "", "/myapp/users/gopher"},
+		{"/users/gopher", http.StatusNotFound, "404 page not found\n", ""},
+		{"/myappx/users/gopher", http.StatusNotFound, "404 page not found\n", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) ||
+			w.Header().Get("Location") != test.location {
+			t.Errorf("Wrong response for %s: want %d %q %q, got %d %q %q", test.path, test.code,
+				test.body, test.location, w.Code, w.Body.String(), w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterLookupRequestStripPrefix(t *testing.T) {
+	router := New()
+	router.StripPrefix("/myapp")
+	router.GET("/users/:name", fakeHandler(""))
+
+	r, _ := http.NewRequest(http.MethodGet, "/myapp/users/gopher", nil)
+	handle, req, _ := router.LookupRequest(r)
+	if handle == nil {
+		t.Fatal("Route below the prefix not found")
+	}
+	if name := ParamsFromContext(req.Context()).ByName("name"); name != "gopher" {
+		t.Errorf("Wrong param: %q", name)
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/users/gopher", nil)
+	if handle, _, _ := router.LookupRequest(r); handle != nil {
+		t.Error("Route found for a path without the prefix")
+	}
+}
+
+func TestRouterHeadFallsBackToGet(t *testing.T) {
+	router := New()
+	router.GET("/page", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Page", "get")
+		w.Write([]byte("body"))
+	})
+	router.HEAD("/head", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Page", "head")
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(http.MethodHead, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("/page"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD fell back to GET although disabled: Code=%d", w.Code)
+	}
+
+	router.HeadFallsBackToGet = true
+	if w := serve("/page"); w.Code != http.StatusOK || w.Header().Get("X-Page") != "get" || w.Body.Len() != 0 ||
+		w.Header().Get("Content-Length") != "4" {
+		t.Errorf("HEAD did not fall back to GET: Code=%d, Header=%v, Body=%q", w.Code, w.Header(), w.Body.String())
+	}
+	if w := serve("/head"); w.Code != http.StatusOK || w.Header().Get("X-Page") != "head" {
+		t.Errorf("HEAD route not preferred: Code=%d, Header=%v", w.Code, w.Header())
+	}
+	if w := serve("/none"); w.Code != http.StatusNotFound {
+		t.Errorf("Wrong status for a missing route: %d", w.Code)
+	}
+}
+
+func TestRouterAny(t *testing.T) {
+	var got string
+	router := New()
+	router.GET("/users/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		got = "route " + ps.ByName("name")
+	})
+	router.Any(func(w http.ResponseWriter, r *http.Request, ps Params) {
+		got = "any " + r.Method + " " + r.URL.Path
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		want   string
+	}{
+		{http.MethodGet, "/users/gopher", http.StatusOK, "route gopher"},
+		{http.MethodPost, "/users/gopher", http.StatusTeapot, "any POST /users/gopher"},
+		{http.MethodGet, "/missing", http.StatusTeapot, "any GET /missing"},
+		{"PURGE", "/cache/key", http.StatusTeapot, "any PURGE /cache/key"},
+		{http.MethodGet, "/users/gopher/", http.StatusMovedPermanently, ""},
+	}
+	for _, test := range tests {
+		got = ""
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || got != test.want {
+			t.Errorf("Wrong handling of %s %s: want %d %q, got %d %q",
+				test.method, test.path, test.code, test.want, w.Code, got)
+		}
+	}
+}
+
+func TestRouterIncludeOptionsInAllow(t *testing.T) {
+	router := New()
+	router.GET("/custom", fakeHandler(""))
+	router.OPTIONS("/custom", fakeHandler(""))
+	router.GET("/plain", fakeHandler(""))
+
+	tests := []struct {
+		handleOptions  bool
+		includeOptions bool
+		path           string
+		allow          string
+	}{
+		{true, false, "/plain", "GET, OPTIONS"},
+		{true, false, "/custom", "GET, OPTIONS"},
+		{false, false, "/plain", "GET"},
+		{false, false, "/custom", "GET"},
+		{false, true, "/plain", "GET"},
+		{false, true, "/custom", "GET, OPTIONS"},
+		{true, true, "/plain", "GET, OPTIONS"},
+	}
+	for _, test := range tests {
+		router.HandleOPTIONS = test.handleOptions
+		router.IncludeOptionsInAllow = test.includeOptions
+		r, _ := http.NewRequest(http.MethodPost, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != test.allow {
+			t.Errorf("Wrong Allow header for %s (HandleOPTIONS=%v, IncludeOptionsInAllow=%v): want %q, got %d %q",
+				test.path, test.handleOptions, test.includeOptions, test.allow, w.Code, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestRouterAlias(t *testing.T) {
+	router := New()
+	router.GET("/users/:id/files/*path", func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte(ps.ByName("id") + " " + ps.ByName("path")))
+	})
+	router.Alias(http.MethodGet, "/user/:id/f/*path", "/users/:id/files/*path", true)
+	router.Alias(http.MethodGet, "/u/:id/*path", "/users/:id/files/*path", false)
+	router.Alias(http.MethodPost, "/old/:id", "/new/:id", true)
+	router.Alias(http.MethodGet, "/missing", "/nowhere", false)
+
+	tests := []struct {
+		method   string
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{http.MethodGet, "/user/42/f/a/b.txt?raw=1", http.StatusMovedPermanently, "", "/users/42/files/a/b.txt?raw=1"},
+		{http.MethodPost, "/old/42", http.StatusPermanentRedirect, "", "/new/42"},
+		{http.MethodGet, "/u/42/a/b.txt", http.StatusOK, "42 /a/b.txt", ""},
+		{http.MethodGet, "/missing", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) ||
+			w.Header().Get("Location") != test.location {
+			t.Errorf("Wrong response for %s %s: want %d %q %q, got %d %q %q", test.method, test.path,
+				test.code, test.body, test.location, w.Code, w.Body.String(), w.Header().Get("Location"))
+		}
+	}
+
+	if recv := catchPanic(func() {
+		router.Alias(http.MethodGet, "/v1/:id", "/v2/:name", false)
+	}); recv == nil {
+		t.Error("alias with a missing param did not panic")
+	}
+	if recv := catchPanic(func() {
+		router.Alias(http.MethodGet, "/self/:id", "/self/:id", false)
+	}); recv == nil {
+		t.Error("alias of itself did not panic")
+	}
+}
+
+func TestRouterAliasPathExtractor(t *testing.T) {
+	var got string
+	router := New()
+	router.PathExtractor = func(req *http.Request) string {
+		return req.Header.Get("X-Original-Path")
+	}
+	router.GET("/users/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		got = ps.ByName("id")
+	})
+	router.Alias(http.MethodGet, "/user/:id", "/users/:id", false)
+
+	r, _ := http.NewRequest(http.MethodGet, "/ignored", nil)
+	r.Header.Set("X-Original-Path", "/user/42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || got != "42" {
+		t.Errorf("Wrong dispatch of the alias: Code=%d, id=%q", w.Code, got)
+	}
+}
+
+func TestRouterAliasDispatch(t *testing.T) {
+	var calls int
+	var got string
+	router := New()
+	router.UnescapePathParams = true
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			calls++
+			next(w, r, ps)
+		}
+	})
+	router.GET("/files/*path", func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		got = r.URL.Path + " " + ps.ByName("path")
+	})
+	router.HostGET("api.example.com", "/v2/:id", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		got = "host " + ps.ByName("id")
+	})
+	router.Alias(http.MethodGet, "/f/*path", "/files/*path", false)
+	router.Alias(http.MethodGet, "/v1/:id", "/v2/:id", false)
+
+	tests := []struct {
+		host string
+		path string
+		want string
+	}{
+		{"", "/f/a%20b.txt", "/files/a b.txt /a b.txt"},
+		{"api.example.com", "/v1/42", "host 42"},
+	}
+	for _, test := range tests {
+		calls, got = 0, ""
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || got != test.want || calls != 1 {
+			t.Errorf("Wrong dispatch of %s%s: want %q once, got %d %q %d times",
+				test.host, test.path, test.want, w.Code, got, calls)
+		}
+	}
+}
+
+func TestRouterExactMatchOnly(t *testing.T) {
+	router := New()
+	router.CatchAllTrailingSlashRedirect = true
+	router.ExactMatchOnly = true
+	router.GET("/admin/users", fakeHandler(""))
+	router.GET("/admin/files/*path", fakeHandler(""))
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/admin/users", http.StatusOK},
+		{"/admin/users/", http.StatusNotFound},
+		{"/Admin/Users", http.StatusNotFound},
+		{"/admin//users", http.StatusNotFound},
+		{"/admin/../admin/users", http.StatusNotFound},
+		{"/admin/files", http.StatusNotFound},
+		{"/admin/files/a.txt", http.StatusOK},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Wrong status for %s: want %d, got %d", test.path, test.code, w.Code)
+		}
+	}
+}
+
+func TestRouterOnRegister(t *testing.T) {
+	var got []string
+	router := New()
+	router.OnRegister = func(method, path string) {
+		got = append(got, method+" "+path)
+	}
+
+	router.GET("/users/:id", fakeHandler(""))
+	router.NewGroup("/api").POST("/items", fakeHandler(""))
+	router.Handle("PURGE", "/cache/*key", fakeHandler(""))
+	catchPanic(func() {
+		router.GET("/users/:id", fakeHandler(""))
+	})
+
+	want := []string{"GET /users/:id", "POST /api/items", "PURGE /cache/*key"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong registrations: want %v, got %v", want, got)
+	}
+}
+
+func TestRouterRegistrationSignatures(t *testing.T) {
+	router := New()
+	group := router.NewGroup("/api")
+
+	// The plain registration methods can be used as func values
+	var reg func(string, Handle) = router.GET
+	var groupReg func(string, Handle) = group.POST
+	var handler func(string, string, http.Handler) = router.Handler
+	reg("/a", fakeHandler(""))
+	groupReg("/b", fakeHandler(""))
+	handler(http.MethodPut, "/c", http.NotFoundHandler())
+
+	if got := len(router.Routes()); got != 3 {
+		t.Errorf("Wrong number of routes: want 3, got %d", got)
+	}
+}
+
+func TestRouterHandleR(t *testing.T) {
+	router := New()
+	router.GETR("/user/:id", fakeHandler("")).Name("user")
+	router.HandleR(http.MethodPost, "/user", fakeHandler("")).Name("create")
+	router.NewGroup("/api").GETR("/items", fakeHandler("")).Name("items")
+
+	for _, name := range []string{"user", "create", "items"} {
+		if _, ok := router.HandlerByName(name); !ok {
+			t.Errorf("Route %q not found by its name", name)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SSEWriter writes Server-Sent Events to a response, see SSE.
+type SSEWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// Send writes an event with the given name and data and flushes it to the
+// client. If the name is empty, the event is dispatched as a "message" event
+// by the client. Data with several lines is sent as several data fields.
+// The returned error is non-nil if the event could not be written, e.g.
+// because the client went away.
+func (s *SSEWriter) Send(event, data string) error {
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: ")
+		b.WriteString(event)
+		b.WriteByte('\n')
+	}
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+
+	if _, err := io.WriteString(s.w, b.String()); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// SSE is an adapter which allows the usage of a function sending
+// Server-Sent Events as a request handle:
+//     router.GET("/events", httprouter.SSE(func(w *httprouter.SSEWriter, r *http.Request, ps httprouter.Params) {...}))
+// The Content-Type header of the response is set to text/event-stream and
+// the header is flushed before the function is called. The request context is
+// canceled when the client goes away.
+// If the http.ResponseWriter does not support flushing, the request is
+// answered with 500 Internal Server Error instead and the function is not
+// called.
+func SSE(handle func(*SSEWriter, *http.Request, Params)) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		header := w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			if errors.Is(err, http.ErrNotSupported) {
+				header.Del("Content-Type")
+				header.Del("Cache-Control")
+				http.Error(w,
+					"streaming not supported",
+					http.StatusInternalServerError,
+				)
+			}
+			return
+		}
+
+		handle(&SSEWriter{w: w, rc: rc}, req, ps)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// noFlushResponseWriter hides the Flush method of the wrapped
+// http.ResponseWriter.
+type noFlushResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestSSE(t *testing.T) {
+	var called bool
+	router := New()
+	router.GET("/events/:topic", SSE(func(w *SSEWriter, _ *http.Request, ps Params) {
+		called = true
+		if err := w.Send("", "hello"); err != nil {
+			t.Error(err)
+		}
+		if err := w.Send(ps.ByName("topic"), "line 1\nline 2"); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	r, _ := http.NewRequest(http.MethodGet, "/events/news", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !called || w.Code != http.StatusOK || !w.Flushed {
+		t.Fatalf("SSE handle failed: called=%v, Code=%d, Flushed=%v", called, w.Code, w.Flushed)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Wrong Content-Type: %q", ct)
+	}
+	want := "data: hello\n\nevent: news\ndata: line 1\ndata: line 2\n\n"
+	if body := w.Body.String(); body != want {
+		t.Errorf("Wrong body: want %q, got %q", want, body)
+	}
+
+	// missing http.Flusher
+	called = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(noFlushResponseWriter{w}, r)
+	if called || w.Code != http.StatusInternalServerError {
+		t.Errorf("SSE without flushing support failed: called=%v, Code=%d", called, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct == "text/event-stream" {
+		t.Errorf("Wrong Content-Type: %q", ct)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"net/http"
+)
+
+// Store is a small request-scoped key/value store, e.g. for the
+// authenticated user or the tenant of a request, which middleware passes down
+// to the handle. Unlike values added with context.WithValue, setting a value
+// does not allocate a new context and request. See Router.ValueStore.
+//
+// The store belongs to a single request and is cleared and reused for other
+// requests once the handle returned, so it must not be retained beyond the
+// request. The store of a handle, which still runs after its timeout
+// expired, see Router.DefaultTimeout, is not reused. Like a map, it is not
+// concurrency-safe.
+type Store struct {
+	entries []storeEntry
+
+	// Set if the store is still used by a handle, which timed out, see
+	// detachStore
+	detached bool
+}
+
+type storeEntry struct {
+	key, val interface{}
+}
+
+// Get returns the value stored under the given key, or nil if none is
+// stored. A nil Store holds no values.
+func (s *Store) Get(key interface{}) interface{} {
+	if s == nil {
+		return nil
+	}
+	for i := range s.entries {
+		if s.entries[i].key == key {
+			return s.entries[i].val
+		}
+	}
+	return nil
+}
+
+// Set stores the value under the given key, replacing any previous value.
+// As with context.WithValue, the key should be of an unexported type.
+func (s *Store) Set(key, val interface{}) {
+	for i := range s.entries {
+		if s.entries[i].key == key {
+			s.entries[i].val = val
+			return
+		}
+	}
+	s.entries = append(s.entries, storeEntry{key, val})
+}
+
+// reset removes all values, so that the store can be reused.
+func (s *Store) reset() {
+	for i := range s.entries {
+		s.entries[i] = storeEntry{}
+	}
+	s.entries = s.entries[:0]
+}
+
+type storeKey struct{}
+
+// Values returns the request-scoped store of the request, or nil if the
+// request was not dispatched by a Router with ValueStore enabled.
+func Values(r *http.Request) *Store {
+	s, _ := r.Context().Value(storeKey{}).(*Store)
+	return s
+}
+
+// WithValue stores the value under the given key in the request-scoped store
+// carried by ctx and returns ctx unchanged. If ctx carries no store, it
+// returns context.WithValue(ctx, key, val) instead, so the value is still
+// passed down with the context.
+func WithValue(ctx context.Context, key, val interface{}) context.Context {
+	if s, ok := ctx.Value(storeKey{}).(*Store); ok {
+		s.Set(key, val)
+		return ctx
+	}
+	return context.WithValue(ctx, key, val)
+}
+
+// Value returns the value stored under the given key with WithValue, either
+// in the request-scoped store carried by ctx or, if ctx carries no store, in
+// ctx itself. Unlike ctx.Value, it finds the value regardless of whether
+// Router.ValueStore is enabled.
+func Value(ctx context.Context, key interface{}) interface{} {
+	if s, ok := ctx.Value(storeKey{}).(*Store); ok {
+		return s.Get(key)
+	}
+	return ctx.Value(key)
+}
+
+// withStore returns a copy of the request carrying a store from the pool of
+// the router.
+func (r *Router) withStore(req *http.Request) (*http.Request, *Store) {
+	s, _ := r.storePool.Get().(*Store)
+	if s == nil {
+		s = new(Store)
+	}
+	return req.WithContext(context.WithValue(req.Context(), storeKey{}, s)), s
+}
+
+// detachStore excludes the store of the request from being reused, since the
+// handle still uses it after the request was answered, like the Params passed
+// to a handle with a timeout.
+func detachStore(req *http.Request) {
+	if s, ok := req.Context().Value(storeKey{}).(*Store); ok {
+		s.detached = true
+	}
+}
+
+func (r *Router) putStore(s *Store) {
+	if s.detached {
+		return
+	}
+	s.reset()
+	r.storePool.Put(s)
+}
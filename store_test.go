@@ -0,0 +1,122 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterValueStore(t *testing.T) {
+	type userKey struct{}
+	type tenantKey struct{}
+
+	var user, tenant, leftover interface{}
+	router := New()
+	router.ValueStore = true
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			leftover = Values(r).Get(userKey{})
+			WithValue(r.Context(), userKey{}, "gopher")
+			next(w, r, ps)
+		}
+	})
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			Values(r).Set(tenantKey{}, ps.ByName("tenant"))
+			next(w, r, ps)
+		}
+	})
+	router.GET("/t/:tenant", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		user = Values(r).Get(userKey{})
+		tenant = Values(r).Get(tenantKey{})
+	})
+
+	for _, name := range []string{"acme", "initech"} {
+		r, _ := http.NewRequest(http.MethodGet, "/t/"+name, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if user != "gopher" || tenant != name {
+			t.Errorf("Wrong values: user=%v, tenant=%v", user, tenant)
+		}
+		if leftover != nil {
+			t.Errorf("Store was not cleared between requests: %v", leftover)
+		}
+	}
+}
+
+func TestWithValueWithoutStore(t *testing.T) {
+	type key struct{}
+
+	ctx := WithValue(context.Background(), key{}, "value")
+	if v := ctx.Value(key{}); v != "value" {
+		t.Errorf("Value not stored in the context: %v", v)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	if s := Values(r); s != nil || s.Get(key{}) != nil {
+		t.Errorf("Unexpected store: %v", s)
+	}
+}
+
+func TestRouterValueStoreTimeout(t *testing.T) {
+	type userKey struct{}
+
+	done := make(chan interface{}, 1)
+	router := New()
+	router.ValueStore = true
+	router.Use(func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			Values(r).Set(userKey{}, ps.ByName("user"))
+			next(w, r, ps)
+		}
+	})
+	router.GETR("/slow/:user", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		time.Sleep(50 * time.Millisecond)
+		done <- Values(r).Get(userKey{})
+	}).Timeout(10 * time.Millisecond)
+	router.GET("/fast/:user", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	r, _ := http.NewRequest(http.MethodGet, "/slow/alice", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Timeout did not expire: Code=%d", w.Code)
+	}
+
+	// another request must not get the store still used by the slow handle
+	r, _ = http.NewRequest(http.MethodGet, "/fast/bob", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if user := <-done; user != "alice" {
+		t.Errorf("Store of the timed out handle was reused: user=%v", user)
+	}
+}
+
+func TestValue(t *testing.T) {
+	type key struct{}
+
+	for _, valueStore := range []bool{false, true} {
+		var got interface{}
+		router := New()
+		router.ValueStore = valueStore
+		router.Use(func(next Handle) Handle {
+			return func(w http.ResponseWriter, r *http.Request, ps Params) {
+				next(w, r.WithContext(WithValue(r.Context(), key{}, "value")), ps)
+			}
+		})
+		router.GET("/", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+			got = Value(r.Context(), key{})
+		})
+
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if got != "value" {
+			t.Errorf("Wrong value with ValueStore=%v: %v", valueStore, got)
+		}
+	}
+}
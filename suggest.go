@@ -0,0 +1,48 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+// suggestRoute returns the path of the registered route closest to the given
+// request path by edit distance, or an empty string if no route is close
+// enough, see SuggestRoutes.
+func (r *Router) suggestRoute(path string) string {
+	var suggestion string
+	best := -1
+	for _, route := range r.routes {
+		if route.path == "*" || !route.Enabled() {
+			continue
+		}
+		d := levenshtein(path, route.path)
+		if d > len(route.path)/2 {
+			continue
+		}
+		if best < 0 || d < best {
+			suggestion, best = route.path, d
+		}
+	}
+	return suggestion
+}
+
+// levenshtein returns the edit distance of a and b, i.e. the minimum number of
+// inserted, deleted or substituted bytes to turn a into b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,80 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"kitten", "sitting", 3},
+		{"/usres", "/users", 2},
+	}
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b); got != test.want {
+			t.Errorf("Wrong distance of %q and %q: want %d, got %d", test.a, test.b, test.want, got)
+		}
+	}
+}
+
+func TestRouterSuggestRoutes(t *testing.T) {
+	router := New()
+	router.GET("/users", fakeHandler(""))
+	router.GET("/users/:id", fakeHandler(""))
+	router.GET("/articles", fakeHandler(""))
+
+	serve := func(path string) string {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Wrong status for %s: %d", path, w.Code)
+		}
+		return w.Header().Get("X-Suggested-Route")
+	}
+
+	if got := serve("/usres"); got != "" {
+		t.Errorf("Route suggested although disabled: %q", got)
+	}
+
+	router.SuggestRoutes = true
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/usres", "/users"},
+		{"/artcles", "/articles"},
+		{"/user/:id", "/users/:id"},
+		{"/completely/different/path", ""},
+	}
+	for _, test := range tests {
+		if got := serve(test.path); got != test.want {
+			t.Errorf("Wrong suggestion for %s: want %q, got %q", test.path, test.want, got)
+		}
+	}
+}
+
+func TestRouterSuggestRoutesStripPrefix(t *testing.T) {
+	router := New()
+	router.SuggestRoutes = true
+	router.StripPrefix("/app")
+	router.GET("/users", fakeHandler(""))
+
+	r, _ := http.NewRequest(http.MethodGet, "/app/usres", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get("X-Suggested-Route"); w.Code != http.StatusNotFound || got != "/users" {
+		t.Errorf("Wrong suggestion for the path without the prefix: Code=%d, got %q", w.Code, got)
+	}
+}
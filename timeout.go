@@ -0,0 +1,139 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeoutWriter is the http.ResponseWriter passed to handles with a timeout.
+// The header is only written to the wrapped http.ResponseWriter, if the
+// timeout did not expire before.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	if code >= 200 {
+		tw.wroteHeader = true
+	}
+
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.w.Write(p)
+}
+
+// FlushError flushes the response, see http.ResponseController.
+func (tw *timeoutWriter) FlushError() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return http.NewResponseController(tw.w).Flush()
+}
+
+// Flush implements the http.Flusher interface.
+func (tw *timeoutWriter) Flush() {
+	tw.FlushError()
+}
+
+// timeout marks the response as timed out and reports true, if the header was
+// not written yet.
+func (tw *timeoutWriter) timeout() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.wroteHeader {
+		return false
+	}
+	tw.timedOut = true
+	return true
+}
+
+// withTimeout runs the handle with the given timeout, see
+// Router.DefaultTimeout.
+func (r *Router) withTimeout(timeout time.Duration, handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+
+		// The handle may outlive this call, while the params are put back
+		// into the pool of the router
+		if ps != nil {
+			ps = append(Params(nil), ps...)
+		}
+
+		tw := &timeoutWriter{w: w, h: make(http.Header)}
+		done := make(chan struct{})
+		panicChan := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if rcv := recover(); rcv != nil {
+					panicChan <- rcv
+				}
+			}()
+			handle(tw, req, ps)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return
+		case rcv := <-panicChan:
+			panic(rcv)
+		case <-ctx.Done():
+		}
+
+		if tw.timeout() {
+			// The handle keeps running with the request-scoped store
+			detachStore(req)
+			r.setRetryAfter(w)
+			r.Error(w, req, http.StatusServiceUnavailable)
+			return
+		}
+
+		// The response was already started, let the handle complete it
+		select {
+		case <-done:
+		case rcv := <-panicChan:
+			panic(rcv)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterDefaultTimeout(t *testing.T) {
+	writeErr := make(chan error, 1)
+	release := make(chan struct{})
+
+	router := New()
+	router.DefaultTimeout = 10 * time.Millisecond
+	router.GET("/slow", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		<-release
+		_, err := w.Write([]byte("too late"))
+		writeErr <- err
+	})
+	router.GET("/started/:name", func(w http.ResponseWriter, r *http.Request, ps Params) {
+		w.WriteHeader(http.StatusOK)
+		<-r.Context().Done()
+		w.Write([]byte(ps.ByName("name") + ": " + r.Context().Err().Error()))
+	})
+	router.GET("/fast", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Fast", "yes")
+		w.Write([]byte("fast"))
+	})
+
+	// the timeout expires before the header is written
+	r, _ := http.NewRequest(http.MethodGet, "/slow", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Timeout before writing failed: Code=%d", w.Code)
+	}
+	close(release)
+	if err := <-writeErr; err != http.ErrHandlerTimeout {
+		t.Errorf("Write after timeout did not fail: %v", err)
+	}
+
+	// the timeout expires after the header is written
+	r, _ = http.NewRequest(http.MethodGet, "/started/gopher", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "gopher: context deadline exceeded" {
+		t.Errorf("Timeout after writing failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/fast", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "fast" || w.Header().Get("X-Fast") != "yes" {
+		t.Errorf("Request within timeout failed: Code=%d, Body=%q, Header=%v", w.Code, w.Body.String(), w.Header())
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	router := New()
+	router.DefaultTimeout = 10 * time.Millisecond
+	router.GETR("/disabled", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		time.Sleep(20 * time.Millisecond)
+		if r.Context().Err() != nil {
+			t.Error("Context canceled despite disabled timeout")
+		}
+	}).Timeout(0)
+	router.GETR("/longer", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		time.Sleep(20 * time.Millisecond)
+	}).Timeout(time.Minute)
+	router.GETR("/shorter", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		time.Sleep(20 * time.Millisecond)
+	}).Timeout(time.Millisecond)
+
+	tests := []struct {
+		route string
+		code  int
+	}{
+		{"/disabled", http.StatusOK},
+		{"/longer", http.StatusOK},
+		{"/shorter", http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("Wrong status for %s: want %d, got %d", test.route, test.code, w.Code)
+		}
+	}
+}
+
+func TestRouterTimeoutPanic(t *testing.T) {
+	var recovered interface{}
+	router := New()
+	router.DefaultTimeout = time.Second
+	router.PanicHandler = func(_ http.ResponseWriter, _ *http.Request, rcv interface{}) {
+		recovered = rcv
+	}
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/panic", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if recovered != "oops!" {
+		t.Errorf("Panic was not passed to the PanicHandler: %v", recovered)
+	}
+}
+
+func TestRouterRetryAfter(t *testing.T) {
+	router := New()
+	router.DefaultTimeout = time.Millisecond
+	router.GET("/slow", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	router.GET("/fast", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	tests := []struct {
+		retryAfter time.Duration
+		route      string
+		header     string
+	}{
+		{0, "/slow", ""},
+		{30 * time.Second, "/slow", "30"},
+		{1500 * time.Millisecond, "/slow", "2"},
+		{30 * time.Second, "/fast", ""},
+	}
+	for _, test := range tests {
+		router.RetryAfter = test.retryAfter
+		r, _ := http.NewRequest(http.MethodGet, test.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if got := w.Header().Get("Retry-After"); got != test.header {
+			t.Errorf("Wrong Retry-After for %s with %v: want %q, got %q (Code=%d)",
+				test.route, test.retryAfter, test.header, got, w.Code)
+		}
+	}
+}
+
+func TestRouteTimeoutDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	router := New()
+	router.GETR("/deadline", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		deadline, ok = r.Context().Deadline()
+	}).Timeout(time.Minute)
+	router.GET("/none", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		deadline, ok = r.Context().Deadline()
+	})
+
+	start := time.Now()
+	r, _ := http.NewRequest(http.MethodGet, "/deadline", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !ok || deadline.Before(start.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		t.Errorf("Wrong deadline in the context of the handle: %v, %v", deadline, ok)
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/none", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if ok {
+		t.Errorf("Deadline set without a timeout: %v", deadline)
+	}
+}
@@ -5,7 +5,10 @@
 package httprouter
 
 import (
+	"fmt"
+	"io"
 	"strings"
+	"sync/atomic"
 	"unicode"
 	"unicode/utf8"
 )
@@ -17,20 +20,70 @@ func min(a, b int) int {
 	return b
 }
 
-func longestCommonPrefix(a, b string) int {
-	i := 0
-	max := min(len(a), len(b))
-	for i < max && a[i] == b[i] {
-		i++
+// Reports whether the path starts with an escaped wildcard character, i.e.
+// '\:' or '\*', which stands for a literal ':' or '*', or a doubled colon '::',
+// which stands for a literal ':'. The literal is always the second byte.
+func isEscape(path string) bool {
+	return len(path) > 1 && ((path[0] == '\\' && (path[1] == ':' || path[1] == '*')) ||
+		(path[0] == ':' && path[1] == ':'))
+}
+
+// Replaces all escaped wildcard characters in the path by their literals.
+func unescapePath(path string) string {
+	if strings.IndexByte(path, '\\') < 0 && !strings.Contains(path, "::") {
+		return path
+	}
+
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if isEscape(path[i:]) {
+			i++
+		}
+		buf = append(buf, path[i])
+	}
+	return string(buf)
+}
+
+// Returns the length of the longest common prefix of the given path, which may
+// contain escaped wildcard characters, and the path of the node.
+// i is the length of the prefix in path, j the length in n.path.
+func (n *node) commonPrefix(path string) (i, j int) {
+	// Wildcard nodes contain no literals and are compared byte by byte
+	wild := n.nType == param || n.nType == catchAll
+
+	for i < len(path) && j < len(n.path) {
+		c, w := path[i], 1
+		if !wild {
+			if isEscape(path[i:]) {
+				c, w = path[i+1], 2
+			} else if c == ':' || c == '*' {
+				// A wildcard never matches a literal
+				return
+			}
+		}
+		if c != n.path[j] {
+			return
+		}
+		i += w
+		j++
 	}
-	return i
+	return
 }
 
 // Search for a wildcard segment and check the name for invalid characters.
+// Escaped wildcard characters are skipped.
 // Returns -1 as index, if no wildcard was found.
 func findWildcard(path string) (wilcard string, i int, valid bool) {
 	// Find start
-	for start, c := range []byte(path) {
+	for start := 0; start < len(path); start++ {
+		c := path[start]
+
+		// Escaped wildcard characters are literals
+		if isEscape(path[start:]) {
+			start++
+			continue
+		}
+
 		// A wildcard starts with ':' (param) or '*' (catch-all)
 		if c != ':' && c != '*' {
 			continue
@@ -51,11 +104,68 @@ func findWildcard(path string) (wilcard string, i int, valid bool) {
 	return "", -1, false
 }
 
+// Checks that all wildcards in the path have distinct names, since the values
+// of wildcards with the same name could otherwise not be told apart.
+func checkWildcardNames(path string) {
+	fullPath := path
+	var names []string
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			return
+		}
+		name := wildcard[1:]
+		for _, n := range names {
+			if n == name && name != "" {
+				panic("duplicate wildcard name '" + name + "' in path '" + fullPath + "'")
+			}
+		}
+		names = append(names, name)
+		path = path[i+len(wildcard):]
+	}
+}
+
+// Checks that a catch-all parameter is the last element of the path. Since the
+// name of a wildcard ends at the next '/', this also rejects catch-all names
+// containing a '/'.
+func checkCatchAll(path string) {
+	fullPath := path
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			return
+		}
+		if wildcard[0] == '*' {
+			if suffix := path[i+len(wildcard):]; suffix != "" {
+				panic("catch-all routes are only allowed at the end of the path, but '" +
+					wildcard + "' is followed by '" + suffix + "' in path '" + fullPath +
+					"'. The catch-all already matches the rest of the path and its name " +
+					"must not contain '/', remove the suffix or use a named parameter instead")
+			}
+			return
+		}
+		path = path[i+len(wildcard):]
+	}
+}
+
 func countParams(path string) uint16 {
 	var n uint16
-	for i := range []byte(path) {
-		switch path[i] {
-		case ':', '*':
+	for i := 0; i < len(path); i++ {
+		switch {
+		case isEscape(path[i:]):
+			i++
+		case path[i] == ':', path[i] == '*':
+			n++
+		}
+	}
+	return n
+}
+
+// Returns the number of non-empty segments of the path.
+func countSegments(path string) int {
+	n := 0
+	for i := 0; i < len(path); i++ {
+		if path[i] != '/' && (i == 0 || path[i-1] == '/') {
 			n++
 		}
 	}
@@ -71,6 +181,25 @@ const (
 	catchAll
 )
 
+// Nodes with more static children than this use a sorted index, which is
+// searched with a binary search instead of a linear scan of the indices.
+var sortedIndexThreshold = 32
+
+func (t nodeType) String() string {
+	switch t {
+	case static:
+		return "static"
+	case root:
+		return "root"
+	case param:
+		return "param"
+	case catchAll:
+		return "catchAll"
+	default:
+		return "invalid"
+	}
+}
+
 type node struct {
 	path      string
 	indices   string
@@ -79,6 +208,65 @@ type node struct {
 	priority  uint32
 	children  []*node
 	handle    Handle
+	fullPath  string
+	route     *Route
+	sorted    *sortedIndex
+
+	// Set if the route of the node is disabled, see Router.SetEnabled. It is
+	// checked by the lookups, so that routes can be toggled while serving.
+	disabled atomic.Bool
+}
+
+// active reports whether the node holds the handle of an enabled route.
+func (n *node) active() bool {
+	return n.handle != nil && !n.disabled.Load()
+}
+
+// sortedIndex holds the index chars and children of a node sorted by the
+// index char.
+type sortedIndex struct {
+	indices  []byte
+	children []*node
+}
+
+// Rebuilds the sorted index of the node, if it has enough children
+func (n *node) updateSortedIndex() {
+	if len(n.indices) <= sortedIndexThreshold {
+		n.sorted = nil
+		return
+	}
+
+	s := &sortedIndex{
+		indices:  []byte(n.indices),
+		children: make([]*node, len(n.children)),
+	}
+	copy(s.children, n.children)
+
+	// Insertion sort, the index is only rebuilt when a route is added
+	for i := 1; i < len(s.indices); i++ {
+		for j := i; j > 0 && s.indices[j] < s.indices[j-1]; j-- {
+			s.indices[j], s.indices[j-1] = s.indices[j-1], s.indices[j]
+			s.children[j], s.children[j-1] = s.children[j-1], s.children[j]
+		}
+	}
+	n.sorted = s
+}
+
+// Returns the child with the given index char using a binary search
+func (s *sortedIndex) child(c byte) *node {
+	lo, hi := 0, len(s.indices)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if s.indices[m] < c {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	if lo < len(s.indices) && s.indices[lo] == c {
+		return s.children[lo]
+	}
+	return nil
 }
 
 // Increments priority of the given child and reorders if necessary
@@ -104,44 +292,95 @@ func (n *node) incrementChildPrio(pos int) int {
 	return newPos
 }
 
-// addRoute adds a node with the given handle to the path.
+// recomputePriorities sets the priority of the node to the sum of the weights
+// of the routes below it and reorders the children by their new priorities.
+// Routes without a weight count as 0.
+func (n *node) recomputePriorities(weights map[string]uint32) uint32 {
+	var prio uint32
+	if n.handle != nil {
+		prio = weights[n.fullPath]
+	}
+	for _, child := range n.children {
+		prio += child.recomputePriorities(weights)
+	}
+	n.priority = prio
+
+	// The wildcard child is always the only child
+	if n.wildChild || len(n.children) < 2 {
+		return prio
+	}
+
+	// Stable insertion sort, like incrementChildPrio the order of children
+	// with the same priority is kept
+	cs := n.children
+	indices := []byte(n.indices)
+	for i := 1; i < len(cs); i++ {
+		for j := i; j > 0 && cs[j-1].priority < cs[j].priority; j-- {
+			cs[j-1], cs[j] = cs[j], cs[j-1]
+			indices[j-1], indices[j] = indices[j], indices[j-1]
+		}
+	}
+	n.indices = string(indices)
+	return prio
+}
+
+// addRoute adds a node with the given handle to the path and returns the leaf
+// node holding the handle.
 // Not concurrency-safe!
-func (n *node) addRoute(path string, handle Handle) {
+func (n *node) addRoute(path string, handle Handle) *node {
+	checkWildcardNames(path)
+	checkCatchAll(path)
+
 	fullPath := path
 	n.priority++
 
 	// Empty tree
 	if n.path == "" && n.indices == "" {
-		n.insertChild(path, fullPath, handle)
+		leaf := n.insertChild(path, fullPath, handle)
 		n.nType = root
-		return
+		return leaf
 	}
 
 walk:
 	for {
 		// Find the longest common prefix.
-		// This also implies that the common prefix contains no ':' or '*'
-		// since the existing key can't contain those chars.
-		i := longestCommonPrefix(path, n.path)
+		// This also implies that the common prefix contains no wildcards,
+		// since the existing key of static nodes can only contain literal
+		// ':' or '*' chars.
+		// i is the length of the prefix in path, j the length in n.path,
+		// which differ if path contains escaped wildcard characters.
+		i, j := n.commonPrefix(path)
 
 		// Split edge
-		if i < len(n.path) {
+		if j < len(n.path) {
 			child := node{
-				path:      n.path[i:],
+				path:      n.path[j:],
 				wildChild: n.wildChild,
 				nType:     static,
 				indices:   n.indices,
 				children:  n.children,
 				handle:    n.handle,
+				fullPath:  n.fullPath,
+				route:     n.route,
+				sorted:    n.sorted,
 				priority:  n.priority - 1,
 			}
 
+			child.disabled.Store(n.disabled.Load())
+			if child.route != nil {
+				child.route.leaf = &child
+			}
+
 			n.children = []*node{&child}
 			// []byte for proper unicode char conversion, see #65
-			n.indices = string([]byte{n.path[i]})
-			n.path = path[:i]
+			n.indices = string([]byte{n.path[j]})
+			n.path = n.path[:j]
 			n.handle = nil
+			n.fullPath = ""
+			n.route = nil
+			n.sorted = nil
 			n.wildChild = false
+			n.disabled.Store(false)
 		}
 
 		// Make new node a child of this node
@@ -175,6 +414,11 @@ walk:
 			}
 
 			idxc := path[0]
+			literal := idxc != ':' && idxc != '*'
+			if isEscape(path) {
+				idxc = path[1]
+				literal = true
+			}
 
 			// '/' after param
 			if n.nType == param && idxc == '/' && len(n.children) == 1 {
@@ -185,7 +429,7 @@ walk:
 
 			// Check if a child with the next path byte exists
 			for i, c := range []byte(n.indices) {
-				if c == idxc {
+				if c == idxc && literal {
 					i = n.incrementChildPrio(i)
 					n = n.children[i]
 					continue walk
@@ -193,28 +437,29 @@ walk:
 			}
 
 			// Otherwise insert it
-			if idxc != ':' && idxc != '*' {
+			if literal {
 				// []byte for proper unicode char conversion, see #65
 				n.indices += string([]byte{idxc})
 				child := &node{}
 				n.children = append(n.children, child)
 				n.incrementChildPrio(len(n.indices) - 1)
+				n.updateSortedIndex()
 				n = child
 			}
-			n.insertChild(path, fullPath, handle)
-			return
+			return n.insertChild(path, fullPath, handle)
 		}
 
 		// Otherwise add handle to current node
-		if n.handle != nil {
+		if n.handle != nil || n.route != nil {
 			panic("a handle is already registered for path '" + fullPath + "'")
 		}
 		n.handle = handle
-		return
+		n.fullPath = fullPath
+		return n
 	}
 }
 
-func (n *node) insertChild(path, fullPath string, handle Handle) {
+func (n *node) insertChild(path, fullPath string, handle Handle) *node {
 	for {
 		// Find prefix until first wildcard
 		wildcard, i, valid := findWildcard(path)
@@ -244,7 +489,7 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 		if wildcard[0] == ':' {
 			if i > 0 {
 				// Insert prefix before the current wildcard
-				n.path = path[:i]
+				n.path = unescapePath(path[:i])
 				path = path[i:]
 			}
 
@@ -271,7 +516,8 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 			// Otherwise we're done. Insert the handle in the new leaf
 			n.handle = handle
-			return
+			n.fullPath = fullPath
+			return n
 		}
 
 		// catchAll
@@ -289,7 +535,7 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 			panic("no / before catch-all in path '" + fullPath + "'")
 		}
 
-		n.path = path[:i]
+		n.path = unescapePath(path[:i])
 
 		// First node: catchAll node with empty path
 		child := &node{
@@ -306,24 +552,27 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 			path:     path[i:],
 			nType:    catchAll,
 			handle:   handle,
+			fullPath: fullPath,
 			priority: 1,
 		}
 		n.children = []*node{child}
 
-		return
+		return child
 	}
 
 	// If no wildcard was found, simply insert the path and handle
-	n.path = path
+	n.path = unescapePath(path)
 	n.handle = handle
+	n.fullPath = fullPath
+	return n
 }
 
-// Returns the handle registered with the given path (key). The values of
-// wildcards are saved to a map.
+// Returns the leaf node holding the handle registered with the given path
+// (key). The values of wildcards are saved to a map.
 // If no handle can be found, a TSR (trailing slash redirect) recommendation is
 // made if a handle exists with an extra (without the) trailing slash for the
 // given path.
-func (n *node) getValue(path string, params func() *Params) (handle Handle, ps *Params, tsr bool) {
+func (n *node) getValue(path string, params func() *Params) (leaf *node, ps *Params, tsr bool) {
 walk: // Outer loop for walking the tree
 	for {
 		prefix := n.path
@@ -336,17 +585,24 @@ walk: // Outer loop for walking the tree
 				// to walk down the tree
 				if !n.wildChild {
 					idxc := path[0]
-					for i, c := range []byte(n.indices) {
-						if c == idxc {
-							n = n.children[i]
+					if n.sorted != nil {
+						if child := n.sorted.child(idxc); child != nil {
+							n = child
 							continue walk
 						}
+					} else {
+						for i, c := range []byte(n.indices) {
+							if c == idxc {
+								n = n.children[i]
+								continue walk
+							}
+						}
 					}
 
 					// Nothing found.
 					// We can recommend to redirect to the same URL without a
 					// trailing slash if a leaf exists for that path.
-					tsr = (path == "/" && n.handle != nil)
+					tsr = (path == "/" && n.active())
 					return
 				}
 
@@ -387,18 +643,25 @@ walk: // Outer loop for walking the tree
 						return
 					}
 
-					if handle = n.handle; handle != nil {
+					if n.active() {
+						leaf = n
 						return
 					} else if len(n.children) == 1 {
 						// No handle found. Check if a handle for this path + a
 						// trailing slash exists for TSR recommendation
 						n = n.children[0]
-						tsr = (n.path == "/" && n.handle != nil) || (n.path == "" && n.indices == "/")
+						tsr = (n.path == "/" && n.active()) || (n.path == "" && n.indices == "/")
 					}
 
 					return
 
 				case catchAll:
+					// The route may require a minimum number of segments
+					if n.route != nil && n.route.minCatchAllSegments > 0 &&
+						countSegments(path) < n.route.minCatchAllSegments {
+						return
+					}
+
 					// Save param value
 					if params != nil {
 						if ps == nil {
@@ -413,7 +676,9 @@ walk: // Outer loop for walking the tree
 						}
 					}
 
-					handle = n.handle
+					if n.active() {
+						leaf = n
+					}
 					return
 
 				default:
@@ -423,7 +688,8 @@ walk: // Outer loop for walking the tree
 		} else if path == prefix {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
-			if handle = n.handle; handle != nil {
+			if n.active() {
+				leaf = n
 				return
 			}
 
@@ -445,8 +711,8 @@ walk: // Outer loop for walking the tree
 			for i, c := range []byte(n.indices) {
 				if c == '/' {
 					n = n.children[i]
-					tsr = (len(n.path) == 1 && n.handle != nil) ||
-						(n.nType == catchAll && n.children[0].handle != nil)
+					tsr = (len(n.path) == 1 && n.active()) ||
+						(n.nType == catchAll && n.children[0].active())
 					return
 				}
 			}
@@ -457,11 +723,17 @@ walk: // Outer loop for walking the tree
 		// extra trailing slash if a leaf exists for that path
 		tsr = (path == "/") ||
 			(len(prefix) == len(path)+1 && prefix[len(path)] == '/' &&
-				path == prefix[:len(prefix)-1] && n.handle != nil)
+				path == prefix[:len(prefix)-1] && n.active())
 		return
 	}
 }
 
+// Reports whether a handle is registered for the given path.
+func (n *node) matches(path string) bool {
+	leaf, _, _ := n.getValue(path, nil)
+	return leaf != nil
+}
+
 // Makes a case-insensitive lookup of the given path and tries to find a handler.
 // It can optionally also fix trailing slashes.
 // It returns the case-corrected path and a bool indicating whether the lookup
@@ -592,7 +864,7 @@ walk: // Outer loop for walking the tree
 
 				// Nothing found. We can recommend to redirect to the same URL
 				// without a trailing slash if a leaf exists for that path
-				if fixTrailingSlash && path == "/" && n.handle != nil {
+				if fixTrailingSlash && path == "/" && n.active() {
 					return ciPath
 				}
 				return nil
@@ -627,19 +899,23 @@ walk: // Outer loop for walking the tree
 					return nil
 				}
 
-				if n.handle != nil {
+				if n.active() {
 					return ciPath
 				} else if fixTrailingSlash && len(n.children) == 1 {
 					// No handle found. Check if a handle for this path + a
 					// trailing slash exists
 					n = n.children[0]
-					if n.path == "/" && n.handle != nil {
+					if n.path == "/" && n.active() {
 						return append(ciPath, '/')
 					}
 				}
 				return nil
 
 			case catchAll:
+				if n.route != nil && n.route.minCatchAllSegments > 0 &&
+					countSegments(path) < n.route.minCatchAllSegments {
+					return nil
+				}
 				return append(ciPath, path...)
 
 			default:
@@ -648,7 +924,7 @@ walk: // Outer loop for walking the tree
 		} else {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
-			if n.handle != nil {
+			if n.active() {
 				return ciPath
 			}
 
@@ -658,8 +934,8 @@ walk: // Outer loop for walking the tree
 				for i, c := range []byte(n.indices) {
 					if c == '/' {
 						n = n.children[i]
-						if (len(n.path) == 1 && n.handle != nil) ||
-							(n.nType == catchAll && n.children[0].handle != nil) {
+						if (len(n.path) == 1 && n.active()) ||
+							(n.nType == catchAll && n.children[0].active()) {
 							return append(ciPath, '/')
 						}
 						return nil
@@ -677,9 +953,28 @@ walk: // Outer loop for walking the tree
 			return ciPath
 		}
 		if len(path)+1 == npLen && n.path[len(path)] == '/' &&
-			strings.EqualFold(path[1:], n.path[1:len(path)]) && n.handle != nil {
+			strings.EqualFold(path[1:], n.path[1:len(path)]) && n.active() {
 			return append(ciPath, n.path...)
 		}
 	}
 	return nil
 }
+
+// Writes a readable representation of the tree to w, one node per line.
+// Each line consists of the indented path of the node, its type, its priority
+// and, if the node holds a handle, the full path of the route.
+func (n *node) dump(w io.Writer, indent string) {
+	path := n.path
+	if path == "" {
+		path = `""`
+	}
+	fmt.Fprintf(w, "%s%s [%s, prio %d]", indent, path, n.nType, n.priority)
+	if n.handle != nil {
+		fmt.Fprintf(w, " -> %s", n.fullPath)
+	}
+	fmt.Fprintln(w)
+
+	for _, child := range n.children {
+		child.dump(w, indent+"  ")
+	}
+}
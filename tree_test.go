@@ -46,17 +46,17 @@ func getParams() *Params {
 
 func checkRequests(t *testing.T, tree *node, requests testRequests) {
 	for _, request := range requests {
-		handler, psp, _ := tree.getValue(request.path, getParams)
+		leaf, psp, _ := tree.getValue(request.path, getParams)
 
 		switch {
-		case handler == nil:
+		case leaf == nil:
 			if !request.nilHandler {
 				t.Errorf("handle mismatch for route '%s': Expected non-nil handle", request.path)
 			}
 		case request.nilHandler:
 			t.Errorf("handle mismatch for route '%s': Expected nil handle", request.path)
 		default:
-			handler(nil, nil, nil)
+			leaf.handle(nil, nil, nil)
 			if fakeHandlerValue != request.route {
 				t.Errorf("handle mismatch for route '%s': Wrong handle (%s != %s)", request.path, fakeHandlerValue, request.route)
 			}
@@ -328,6 +328,29 @@ func TestTreeCatchAllConflict(t *testing.T) {
 	testRoutes(t, routes)
 }
 
+func TestTreeCatchAllSuffix(t *testing.T) {
+	tests := []struct {
+		path   string
+		suffix string
+	}{
+		{"/src/*filepath/x", "/x"},
+		{"/src/*file/path", "/path"},
+		{"/src/*filepath/", "/"},
+		{"/:user/*filepath/:id", "/:id"},
+		{"/src/\\*star/*filepath/x/y", "/x/y"},
+	}
+	for _, test := range tests {
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.addRoute(test.path, nil)
+		})
+		msg, _ := recv.(string)
+		if !strings.Contains(msg, "is followed by '"+test.suffix+"' in path '"+test.path+"'") {
+			t.Errorf("Unexpected panic for path '%s': %v", test.path, recv)
+		}
+	}
+}
+
 func TestTreeCatchAllConflictRoot(t *testing.T) {
 	routes := []testRoute{
 		{"/", false},
@@ -364,6 +387,117 @@ func TestTreeDoubleWildcard(t *testing.T) {
 	}
 }
 
+func TestTreeEscapedWildcard(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		`/repos/:owner/\*star`,
+		`/repos/:owner/\*stargazers`,
+		`/files/C\:/readme`,
+		`/files/C\:/other`,
+		`/files/C`,
+		`/files/Cx/*filepath`,
+		`/a\:b`,
+		`/a\:c/:id`,
+		`/back\slash`,
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/repos/golang/*star", false, `/repos/:owner/\*star`, Params{Param{"owner", "golang"}}},
+		{"/repos/golang/*stargazers", false, `/repos/:owner/\*stargazers`, Params{Param{"owner", "golang"}}},
+		{"/repos/golang/x", true, "", Params{Param{"owner", "golang"}}},
+		{"/repos/golang/\\*star", true, "", Params{Param{"owner", "golang"}}},
+		{"/files/C:/readme", false, `/files/C\:/readme`, nil},
+		{"/files/C:/other", false, `/files/C\:/other`, nil},
+		{"/files/C", false, `/files/C`, nil},
+		{"/files/Cx/readme", false, `/files/Cx/*filepath`, Params{Param{"filepath", "/readme"}}},
+		{"/files/C/readme", true, "", nil},
+		{"/a:b", false, `/a\:b`, nil},
+		{"/a:c/1", false, `/a\:c/:id`, Params{Param{"id", "1"}}},
+		{"/ab", true, "", nil},
+		{"/back\\slash", false, `/back\slash`, nil},
+	})
+
+	checkPriorities(t, tree)
+
+	if n := countParams(`/repos/:owner/\*star/\:x`); n != 1 {
+		t.Errorf("Wrong number of params: %d", n)
+	}
+}
+
+func TestTreeDoubledColon(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/ns/::system",
+		"/ns/::system/:id",
+		"/time/12::00",
+		"/a/:::name",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/ns/:system", false, "/ns/::system", nil},
+		{"/ns/:system/1", false, "/ns/::system/:id", Params{Param{"id", "1"}}},
+		{"/ns/kube", true, "", nil},
+		{"/ns/system", true, "", nil},
+		{"/ns/::system", true, "", nil},
+		{"/time/12:00", false, "/time/12::00", nil},
+		{"/a/:gopher", false, "/a/:::name", Params{Param{"name", "gopher"}}},
+	})
+
+	checkPriorities(t, tree)
+
+	if n := countParams("/ns/::system/:id"); n != 1 {
+		t.Errorf("Wrong number of params: %d", n)
+	}
+}
+
+func TestTreeEscapedWildcardConflict(t *testing.T) {
+	routes := []testRoute{
+		{`/x/\:lit`, false},
+		{`/x/:param`, true},
+		{`/y/:param`, false},
+		{`/y/\:lit`, true},
+		{`/z/\*lit`, false},
+		{`/z/*catch`, true},
+		{`/z/:lit`, true},
+	}
+	testRoutes(t, routes)
+}
+
+func TestTreeDuplicateWildcard(t *testing.T) {
+	const panicMsg = "duplicate wildcard name"
+
+	routes := [...]string{
+		"/:id/:name/:id",
+		"/:id/*id",
+		"/user/:id/details/:id/",
+	}
+
+	for i := range routes {
+		route := routes[i]
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.addRoute(route, nil)
+		})
+
+		if rs, ok := recv.(string); !ok || !strings.HasPrefix(rs, panicMsg) {
+			t.Fatalf(`"Expected panic "%s" for route '%s', got "%v"`, panicMsg, route, recv)
+		}
+	}
+
+	testRoutes(t, []testRoute{
+		{"/user/:id/:name/:other", false},
+		{"/files/:id/*filepath", false},
+	})
+}
+
 func TestTreeTrailingSlashRedirect(t *testing.T) {
 	tree := &node{}
 
@@ -719,3 +853,76 @@ func TestRedirectTrailingSlash(t *testing.T) {
 		t.Fatalf("want true, is false")
 	}
 }
+
+func wideFanOutRoutes() []string {
+	routes := make([]string, 0, 256)
+	for i := 0; i < 256; i++ {
+		switch c := byte(i); c {
+		case ':', '*':
+			// wildcards
+		default:
+			routes = append(routes, "/wide/"+string([]byte{c})+"/item")
+		}
+	}
+	return routes
+}
+
+func TestTreeWideFanOut(t *testing.T) {
+	tree := &node{}
+
+	routes := wideFanOutRoutes()
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+	if tree.sorted == nil {
+		t.Fatal("no sorted index for wide node")
+	}
+
+	// split the edge of the node with the sorted index
+	tree.addRoute("/w", fakeHandler("/w"))
+	if tree.sorted != nil || tree.children[0].sorted == nil {
+		t.Fatal("sorted index not moved to child node")
+	}
+
+	requests := testRequests{
+		{"/w", false, "/w", nil},
+		{"/wide/:/item", true, "", nil},
+		{"/wide/a/it", true, "", nil},
+	}
+	for _, route := range routes {
+		requests = append(requests, struct {
+			path       string
+			nilHandler bool
+			route      string
+			ps         Params
+		}{route, false, route, nil})
+	}
+	checkRequests(t, tree, requests)
+	checkPriorities(t, tree)
+}
+
+func BenchmarkTreeWideFanOut(b *testing.B) {
+	routes := wideFanOutRoutes()
+	bench := func(b *testing.B, threshold int) {
+		defer func(t int) { sortedIndexThreshold = t }(sortedIndexThreshold)
+		sortedIndexThreshold = threshold
+
+		tree := &node{}
+		for _, route := range routes {
+			tree.addRoute(route, fakeHandler(route))
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tree.getValue(routes[i%len(routes)], nil)
+		}
+	}
+
+	b.Run("Linear", func(b *testing.B) {
+		bench(b, len(routes))
+	})
+	b.Run("Sorted", func(b *testing.B) {
+		bench(b, 0)
+	})
+}